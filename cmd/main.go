@@ -1,9 +1,11 @@
 package main
 
 import (
+	"CommentTree/internal/activitypub"
 	"CommentTree/internal/repository"
 	"CommentTree/internal/router"
 	"CommentTree/internal/router/handlers"
+	"CommentTree/internal/router/middleware"
 	"CommentTree/internal/service"
 	"CommentTree/pkg/logger"
 	"errors"
@@ -25,9 +27,19 @@ func main() {
 	if err != nil {
 		log.Fatal("Failed to connect to database", zap.Error(err))
 	}
-	serviceComment := service.NewService(repo, log)
-	handlersComment := handlers.NewCommentHandler(*serviceComment)
-	rout := router.NewRouter(cfg.GetString("log_level"), handlersComment, log)
+	serviceComment := service.NewService(repo, log, cfg.GetBool("moderation.enabled"))
+	handlersComment := handlers.NewCommentHandler(serviceComment)
+	authMiddleware := middleware.NewAPIKeyAuth(cfg.GetString("admin_api_key"))
+
+	var apHandler *activitypub.Handler
+	if baseURL := cfg.GetString("activitypub.base_url"); baseURL != "" {
+		verifier := activitypub.NewHTTPSigVerifier(activitypub.FetchActorPublicKey)
+		outbox := activitypub.NewOutbox(repo, baseURL, log)
+		apHandler = activitypub.NewHandler(serviceComment, baseURL, verifier, repo, activitypub.FetchActorInbox, outbox, log)
+		serviceComment.SetFederationPublisher(outbox)
+	}
+
+	rout := router.NewRouter(cfg.GetString("log_level"), handlersComment, authMiddleware, apHandler, log)
 	srv := &http.Server{
 		Addr:    cfg.GetString("addr"),
 		Handler: rout.GetEngine(),
@@ -0,0 +1,124 @@
+// Package activitypub exposes this instance's comment tree as an
+// ActivityPub actor: an actor document, a Note object per comment (keyed by
+// path_id), an inbox that accepts federated replies as Create{Note}
+// activities, and an outbox queue that announces locally-approved comments
+// to followers.
+package activitypub
+
+import (
+	"CommentTree/internal/models"
+	"CommentTree/internal/service"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	ap "github.com/go-ap/activitypub"
+	"github.com/wb-go/wbf/ginext"
+	"go.uber.org/zap"
+)
+
+// ActivityDeliverer enqueues a one-off outbound activity delivery. Outbox
+// satisfies it via Deliver; Handler uses it to reply to a Follow with an
+// Accept without blocking the inbox request that triggered it.
+type ActivityDeliverer interface {
+	Deliver(inboxURL string, body []byte)
+}
+
+// Handler serves the actor-facing ActivityPub endpoints. Bulk outbound
+// delivery (announcing comments to followers) lives in Outbox; Handler
+// additionally uses it to deliver the one-off Accept it owes a new
+// follower.
+type Handler struct {
+	service    *service.Service
+	baseURL    string
+	verifier   SignatureVerifier
+	followers  FollowerStore
+	fetchInbox ActorInboxFetcher
+	deliverer  ActivityDeliverer
+	log        *zap.Logger
+}
+
+// NewHandler builds a Handler. baseURL is this instance's externally visible
+// origin (e.g. "https://comments.example.com"), used to build the actor,
+// inbox and object IRIs served to remote instances. followers and deliverer
+// back Follow/Undo handling in Inbox; fetchInbox resolves a new follower's
+// inbox URL from its actor document.
+func NewHandler(svc *service.Service, baseURL string, verifier SignatureVerifier, followers FollowerStore, fetchInbox ActorInboxFetcher, deliverer ActivityDeliverer, log *zap.Logger) *Handler {
+	return &Handler{
+		service:    svc,
+		baseURL:    baseURL,
+		verifier:   verifier,
+		followers:  followers,
+		fetchInbox: fetchInbox,
+		deliverer:  deliverer,
+		log:        log.Named("activitypub"),
+	}
+}
+
+func (h *Handler) actorIRI() ap.IRI {
+	return ap.IRI(h.baseURL + "/actor")
+}
+
+func (h *Handler) inboxIRI() ap.IRI {
+	return ap.IRI(h.baseURL + "/inbox")
+}
+
+func (h *Handler) objectIRI(pathID string) ap.IRI {
+	return objectIRI(h.baseURL, pathID)
+}
+
+// objectIRI builds the stable per-comment object IRI served by Note and
+// announced in outbound Create{Note} activities. It's a free function, not
+// just a Handler method, so Outbox can derive the same IRI without needing a
+// Handler reference.
+func objectIRI(baseURL, pathID string) ap.IRI {
+	return ap.IRI(fmt.Sprintf("%s/activitypub/comments/%s/activity", baseURL, pathID))
+}
+
+// Actor serves GET /actor, the document remote servers fetch to discover our
+// inbox and outbox. It publishes no public key, and Outbox sends its
+// deliveries unsigned.
+func (h *Handler) Actor(c *ginext.Context) {
+	actor := ap.PersonNew(h.actorIRI())
+	actor.PreferredUsername = ap.NaturalLanguageValuesNew()
+	_ = actor.PreferredUsername.Set(ap.NilLangRef, ap.Content("comments"))
+	actor.Inbox = h.inboxIRI()
+	actor.Outbox = ap.IRI(h.baseURL + "/outbox")
+
+	c.JSON(http.StatusOK, actor)
+}
+
+// Note serves GET /activitypub/comments/:path_id/activity, the stable
+// per-comment object other servers dereference to resolve an inReplyTo
+// reference into our tree. It lives under /activitypub rather than
+// /comments so its :path_id wildcard can't collide with the public API's
+// /comments/:id routes on gin's router.
+
+func (h *Handler) Note(c *ginext.Context) {
+	log := c.MustGet("logger").(*zap.Logger)
+	pathID := c.Param("path_id")
+
+	comment, err := h.service.GetCommentByPathID(c.Request.Context(), pathID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, ginext.H{"error": "comment not found"})
+			return
+		}
+		log.Error("Failed to get comment for Note", zap.String("path_id", pathID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ginext.H{"error": "failed to get comment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, noteFromComment(h.actorIRI(), h.objectIRI(pathID), comment))
+}
+
+func noteFromComment(attributedTo, id ap.IRI, comment *models.Comment) *ap.Object {
+	note := ap.ObjectNew(ap.NoteType)
+	note.ID = id
+	note.AttributedTo = attributedTo
+	note.Content = ap.NaturalLanguageValuesNew()
+	_ = note.Content.Set(ap.NilLangRef, ap.Content(comment.Comm))
+	note.Published = comment.CreatedAt
+	return note
+}
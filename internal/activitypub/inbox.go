@@ -0,0 +1,218 @@
+package activitypub
+
+import (
+	"crypto"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	ap "github.com/go-ap/activitypub"
+	"github.com/go-fed/httpsig"
+	"github.com/google/uuid"
+	"github.com/wb-go/wbf/ginext"
+	"go.uber.org/zap"
+)
+
+// SignatureVerifier authenticates an inbound ActivityPub delivery per the
+// HTTP Signatures draft used by the fediverse, resolving the signing key
+// from the keyId the request claims.
+type SignatureVerifier interface {
+	// Verify checks r's Signature header and returns the actor IRI the
+	// request was signed as, or an error if the signature is missing,
+	// malformed, or does not verify against the claimed key.
+	Verify(r *http.Request) (actorIRI string, err error)
+}
+
+// ActorKeyFetcher resolves the PEM-encoded public key published on a remote
+// actor's document, identified by its keyId (the actor IRI with a
+// "#main-key" style fragment).
+type ActorKeyFetcher func(keyID string) (crypto.PublicKey, error)
+
+// ActorInboxFetcher resolves the inbox URL published on a remote actor's
+// document, identified by the actor's IRI. Used to accept a new Follow.
+type ActorInboxFetcher func(actorURL string) (string, error)
+
+// HTTPSigVerifier is the production SignatureVerifier, backed by an
+// ActorKeyFetcher that dereferences the signing actor over HTTP.
+type HTTPSigVerifier struct {
+	fetchKey ActorKeyFetcher
+}
+
+func NewHTTPSigVerifier(fetchKey ActorKeyFetcher) *HTTPSigVerifier {
+	return &HTTPSigVerifier{fetchKey: fetchKey}
+}
+
+func (v *HTTPSigVerifier) Verify(r *http.Request) (string, error) {
+	verifier, err := httpsig.NewVerifier(r)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse signature header: %w", err)
+	}
+
+	keyID := verifier.KeyId()
+	pubKey, err := v.fetchKey(keyID)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve signing key %q: %w", keyID, err)
+	}
+
+	if err := verifier.Verify(pubKey, httpsig.RSA_SHA256); err != nil {
+		return "", fmt.Errorf("signature verification failed: %w", err)
+	}
+
+	return strings.SplitN(keyID, "#", 2)[0], nil
+}
+
+// Inbox serves POST /inbox. It accepts Create{Note} activities that reply
+// to a comment we own and records them via Service.CreateRemoteReply, which
+// is idempotent on the activity's object URL so redelivery is harmless. It
+// also accepts Follow (recording the follower and replying Accept) and Undo
+// (removing it). Every other activity type is accepted (202) but otherwise
+// ignored, per the ActivityPub recommendation to not bounce unsupported
+// side effects.
+func (h *Handler) Inbox(c *ginext.Context) {
+	log := c.MustGet("logger").(*zap.Logger)
+
+	verifiedActorIRI, err := h.verifier.Verify(c.Request)
+	if err != nil {
+		log.Warn("Rejected unsigned or invalid inbox delivery", zap.Error(err))
+		c.JSON(http.StatusUnauthorized, ginext.H{"error": "invalid signature"})
+		return
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		log.Error("Failed to read inbox request body", zap.Error(err))
+		c.JSON(http.StatusBadRequest, ginext.H{"error": "invalid body"})
+		return
+	}
+
+	var activity ap.Activity
+	if err := activity.UnmarshalJSON(body); err != nil {
+		log.Error("Failed to parse inbox activity", zap.Error(err))
+		c.JSON(http.StatusBadRequest, ginext.H{"error": "invalid activity"})
+		return
+	}
+
+	switch activity.Type {
+	case ap.FollowType:
+		h.handleFollow(c, log, verifiedActorIRI, activity)
+		return
+	case ap.UndoType:
+		h.handleUndo(c, log, verifiedActorIRI)
+		return
+	case ap.CreateType:
+		// Falls through to the Create{Note} handling below.
+	default:
+		log.Debug("Ignoring unsupported inbox activity type", zap.String("type", activity.Type.String()))
+		c.JSON(http.StatusAccepted, ginext.H{"status": "ignored"})
+		return
+	}
+
+	note, ok := activity.Object.(*ap.Object)
+	if !ok || note.Type != ap.NoteType {
+		log.Debug("Ignoring Create activity without a Note object")
+		c.JSON(http.StatusAccepted, ginext.H{"status": "ignored"})
+		return
+	}
+
+	parentPathID := pathIDFromObjectIRI(note.InReplyTo.GetLink().String())
+	if parentPathID == "" {
+		log.Debug("Ignoring Note that isn't a reply to one of our comments")
+		c.JSON(http.StatusAccepted, ginext.H{"status": "ignored"})
+		return
+	}
+
+	parent, err := h.service.GetCommentByPathID(c.Request.Context(), parentPathID)
+	if err != nil {
+		log.Warn("Inbox delivery replies to an unknown comment", zap.String("path_id", parentPathID), zap.Error(err))
+		c.JSON(http.StatusUnprocessableEntity, ginext.H{"error": "unknown reply target"})
+		return
+	}
+
+	actorURL := activity.Actor.GetLink().String()
+	if actorURL != verifiedActorIRI {
+		log.Warn("Rejected inbox delivery whose claimed actor doesn't match its signature",
+			zap.String("claimed_actor", actorURL), zap.String("verified_actor", verifiedActorIRI))
+		c.JSON(http.StatusForbidden, ginext.H{"error": "actor does not match signature"})
+		return
+	}
+
+	text := note.Content.First().String()
+	objectURL := note.GetID().String()
+
+	if err := h.service.CreateRemoteReply(c.Request.Context(), parent.ID, text, actorURL, objectURL); err != nil {
+		log.Error("Failed to record remote reply", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ginext.H{"error": "failed to record reply"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, ginext.H{"status": "accepted"})
+}
+
+// handleFollow resolves actorIRI's inbox from its actor document, records it
+// as a follower, and replies with an Accept{Follow}. The Accept is delivered
+// through h.deliverer's background queue so a slow or unreachable follower
+// inbox never blocks this request.
+func (h *Handler) handleFollow(c *ginext.Context, log *zap.Logger, actorIRI string, follow ap.Activity) {
+	ctx := c.Request.Context()
+
+	inboxURL, err := h.fetchInbox(actorIRI)
+	if err != nil {
+		log.Warn("Failed to resolve inbox for new follower", zap.String("actor", actorIRI), zap.Error(err))
+		c.JSON(http.StatusBadRequest, ginext.H{"error": "failed to resolve follower inbox"})
+		return
+	}
+
+	if err := h.followers.AddFollower(ctx, actorIRI, inboxURL); err != nil {
+		log.Error("Failed to record follower", zap.String("actor", actorIRI), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ginext.H{"error": "failed to record follower"})
+		return
+	}
+
+	accept := &ap.Activity{
+		Type:      ap.AcceptType,
+		ID:        ap.IRI(fmt.Sprintf("%s/activities/%s", h.baseURL, uuid.New().String())),
+		Actor:     h.actorIRI(),
+		Object:    &follow,
+		Published: time.Now(),
+	}
+	body, err := accept.MarshalJSON()
+	if err != nil {
+		log.Error("Failed to marshal Accept activity", zap.String("actor", actorIRI), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ginext.H{"error": "failed to accept follow"})
+		return
+	}
+	h.deliverer.Deliver(inboxURL, body)
+
+	c.JSON(http.StatusAccepted, ginext.H{"status": "accepted"})
+}
+
+// handleUndo removes actorIRI as a follower. The only Undo we expect to
+// receive is Undo{Follow}, and Undo's actor is always the one undoing, so
+// there's no need to inspect the wrapped activity.
+func (h *Handler) handleUndo(c *ginext.Context, log *zap.Logger, actorIRI string) {
+	if err := h.followers.RemoveFollower(c.Request.Context(), actorIRI); err != nil {
+		log.Error("Failed to remove follower", zap.String("actor", actorIRI), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ginext.H{"error": "failed to remove follower"})
+		return
+	}
+	c.JSON(http.StatusAccepted, ginext.H{"status": "accepted"})
+}
+
+// pathIDFromObjectIRI extracts the path_id segment from an object IRI shaped
+// like objectIRI's "<baseURL>/activitypub/comments/<path_id>/activity", or
+// returns "" if iri doesn't end in "/comments/<path_id>/activity". The host
+// is not checked; a path_id that isn't ours fails the later lookup.
+func pathIDFromObjectIRI(iri string) string {
+	const suffix = "/activity"
+	if !strings.HasSuffix(iri, suffix) {
+		return ""
+	}
+	trimmed := strings.TrimSuffix(iri, suffix)
+	idx := strings.LastIndex(trimmed, "/comments/")
+	if idx == -1 {
+		return ""
+	}
+	return trimmed[idx+len("/comments/"):]
+}
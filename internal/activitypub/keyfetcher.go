@@ -0,0 +1,140 @@
+package activitypub
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	ap "github.com/go-ap/activitypub"
+)
+
+// actorFetchClient is used for every outbound actor document fetch. Its
+// Transport dials only the IP addresses it resolved and checked itself (so a
+// DNS response can't be swapped between the check and the connect), and it
+// refuses redirects outright, since keyID is attacker-controlled input and
+// following either open to SSRF against internal/cloud-metadata addresses.
+var actorFetchClient = &http.Client{
+	Timeout:   5 * time.Second,
+	Transport: &http.Transport{DialContext: dialPublicOnly},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return errors.New("actor document fetch does not follow redirects")
+	},
+}
+
+// dialPublicOnly resolves addr itself and refuses to connect if any
+// candidate IP is loopback, private, link-local, or otherwise non-public,
+// then dials that exact IP (rather than handing the hostname back to the
+// standard dialer, which would re-resolve and could land on a different,
+// unchecked address).
+func dialPublicOnly(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid dial address %q: %w", addr, err)
+	}
+
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %q: %w", host, err)
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no addresses found for %q", host)
+	}
+	for _, ip := range ips {
+		if isBlockedIP(ip.IP) {
+			return nil, fmt.Errorf("refusing to dial non-public address %s", ip.IP)
+		}
+	}
+
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	return dialer.DialContext(ctx, network, net.JoinHostPort(ips[0].IP.String(), port))
+}
+
+// isBlockedIP reports whether ip is loopback, private, link-local,
+// unspecified, or multicast, i.e. anything that isn't a routable public
+// address a remote actor document should legitimately live at.
+func isBlockedIP(ip net.IP) bool {
+	return ip.IsLoopback() ||
+		ip.IsPrivate() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsUnspecified() ||
+		ip.IsMulticast()
+}
+
+// fetchActorDocument dereferences actorURL and parses it as an ActivityPub
+// actor document. actorURL is always attacker-controlled (it comes from the
+// inbound Signature header or a Follow's actor field), so the fetch is
+// restricted to https and to public IP addresses to avoid SSRF.
+func fetchActorDocument(actorURL string) (*ap.Person, error) {
+	if !strings.HasPrefix(actorURL, "https://") {
+		return nil, fmt.Errorf("refusing to fetch actor document over non-https URL")
+	}
+
+	req, err := http.NewRequest(http.MethodGet, actorURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build actor request: %w", err)
+	}
+	req.Header.Set("Accept", "application/activity+json")
+
+	resp, err := actorFetchClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch actor document: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("actor document fetch returned status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read actor document: %w", err)
+	}
+
+	var actor ap.Person
+	if err := actor.UnmarshalJSON(body); err != nil {
+		return nil, fmt.Errorf("failed to parse actor document: %w", err)
+	}
+	return &actor, nil
+}
+
+// FetchActorPublicKey is the default ActorKeyFetcher: it dereferences the
+// actor document a keyId points at (its fragment, usually "#main-key",
+// stripped) and parses the PEM-encoded public key it publishes.
+func FetchActorPublicKey(keyID string) (crypto.PublicKey, error) {
+	actorURL := strings.SplitN(keyID, "#", 2)[0]
+	actor, err := fetchActorDocument(actorURL)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode([]byte(actor.PublicKey.PublicKeyPem))
+	if block == nil {
+		return nil, fmt.Errorf("actor public key is not valid PEM")
+	}
+	pubKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse actor public key: %w", err)
+	}
+	return pubKey, nil
+}
+
+// FetchActorInbox is the default ActorInboxFetcher: it dereferences actorURL
+// and returns the inbox URL it publishes, used to accept a new Follow.
+func FetchActorInbox(actorURL string) (string, error) {
+	actor, err := fetchActorDocument(actorURL)
+	if err != nil {
+		return "", err
+	}
+	if actor.Inbox == "" {
+		return "", fmt.Errorf("actor document has no inbox")
+	}
+	return actor.Inbox.String(), nil
+}
@@ -0,0 +1,156 @@
+package activitypub
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"CommentTree/internal/models"
+
+	ap "github.com/go-ap/activitypub"
+	"github.com/wb-go/wbf/retry"
+	"go.uber.org/zap"
+)
+
+// outboxQueueSize bounds how many pending deliveries Outbox holds in
+// memory. It is a best-effort fan-out, not a durable queue: deliveries still
+// pending when the process restarts are dropped, since a replayed
+// Create{Note} for an already-approved comment has no further effect beyond
+// re-announcing it.
+const outboxQueueSize = 256
+
+// FollowerStore records and lists the followers outbound activities are
+// delivered to. Repository satisfies this; Inbox uses it to record/forget
+// followers on Follow/Undo, Outbox uses it to list inboxes to deliver to.
+type FollowerStore interface {
+	AddFollower(ctx context.Context, actorURL, inboxURL string) error
+	RemoveFollower(ctx context.Context, actorURL string) error
+	ListFollowerInboxes(ctx context.Context) ([]string, error)
+}
+
+// Outbox announces locally-approved comments to every known ActivityPub
+// follower as a Create{Note} activity, retrying each delivery with the same
+// backoff shape the repository layer uses for transient DB errors.
+type Outbox struct {
+	followers FollowerStore
+	baseURL   string
+	client    *http.Client
+	strategy  retry.Strategy
+	queue     chan delivery
+	log       *zap.Logger
+}
+
+type delivery struct {
+	inboxURL string
+	body     []byte
+}
+
+func NewOutbox(followers FollowerStore, baseURL string, log *zap.Logger) *Outbox {
+	o := &Outbox{
+		followers: followers,
+		baseURL:   baseURL,
+		client:    &http.Client{Timeout: 10 * time.Second},
+		strategy: retry.Strategy{
+			Attempts: 5,
+			Delay:    time.Second,
+			Backoff:  2,
+		},
+		queue: make(chan delivery, outboxQueueSize),
+		log:   log.Named("activitypub.outbox"),
+	}
+	go o.run()
+	return o
+}
+
+func (o *Outbox) run() {
+	for d := range o.queue {
+		if err := o.deliver(d); err != nil {
+			o.log.Error("Failed to deliver activity after retries", zap.String("inbox", d.inboxURL), zap.Error(err))
+		}
+	}
+}
+
+// PublishComment implements service.FederationPublisher. It fans a
+// Create{Note} out to every follower inbox; delivery happens on the Outbox's
+// background goroutine, so a slow or unreachable follower never blocks the
+// request that approved the comment.
+func (o *Outbox) PublishComment(comment *models.Comment) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	inboxes, err := o.followers.ListFollowerInboxes(ctx)
+	if err != nil {
+		o.log.Error("Failed to list followers for outbound delivery", zap.Error(err))
+		return
+	}
+	if len(inboxes) == 0 {
+		return
+	}
+
+	actorIRI := ap.IRI(o.baseURL + "/actor")
+	note := noteFromComment(actorIRI, objectIRI(o.baseURL, comment.PathID), comment)
+
+	create := ap.CreateNew(ap.IRI(fmt.Sprintf("%s/activities/%s", o.baseURL, comment.PathID)), note)
+	create.Actor = actorIRI
+	create.Published = comment.CreatedAt
+
+	body, err := create.MarshalJSON()
+	if err != nil {
+		o.log.Error("Failed to marshal outbound Create activity", zap.Error(err))
+		return
+	}
+
+	for _, inbox := range inboxes {
+		o.Deliver(inbox, body)
+	}
+}
+
+// Deliver enqueues body for background delivery to inboxURL, the same
+// best-effort queue PublishComment fans Create{Note} activities out
+// through. Handler uses it to send one-off replies (e.g. Accept{Follow})
+// without blocking the inbox request that triggered them.
+func (o *Outbox) Deliver(inboxURL string, body []byte) {
+	select {
+	case o.queue <- delivery{inboxURL: inboxURL, body: body}:
+	default:
+		o.log.Warn("Outbox queue full, dropping delivery", zap.String("inbox", inboxURL))
+	}
+}
+
+func (o *Outbox) deliver(d delivery) error {
+	delay := o.strategy.Delay
+	var lastErr error
+	for attempt := 0; attempt < o.strategy.Attempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(delay)
+			delay *= time.Duration(o.strategy.Backoff)
+		}
+		if err := o.post(d); err != nil {
+			lastErr = err
+			continue
+		}
+		return nil
+	}
+	return fmt.Errorf("delivery failed after %d attempts: %w", o.strategy.Attempts, lastErr)
+}
+
+func (o *Outbox) post(d delivery) error {
+	req, err := http.NewRequest(http.MethodPost, d.inboxURL, bytes.NewReader(d.body))
+	if err != nil {
+		return fmt.Errorf("failed to build delivery request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/activity+json")
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach inbox: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("inbox responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -15,6 +15,81 @@ type Comment struct {
 	Comm      string     `json:"comm"`
 	CreatedAt time.Time  `json:"created_at"`
 	Children  []*Comment `json:"children,omitempty"`
+	// Highlight holds a ts_headline snippet around the matched terms. It is
+	// only populated on results returned from the search endpoint.
+	Highlight string `json:"highlight,omitempty"`
+
+	Status      int8       `json:"status"`
+	IP          string     `json:"-"`
+	ModeratedBy *int64     `json:"moderated_by,omitempty"`
+	ModeratedAt *time.Time `json:"moderated_at,omitempty"`
+
+	// RemoteActorURL/RemoteObjectURL are set when a comment originated from
+	// an ActivityPub Create{Note} activity instead of the local API. Both
+	// are nil for comments created locally.
+	RemoteActorURL  *string `json:"remote_actor_url,omitempty"`
+	RemoteObjectURL *string `json:"remote_object_url,omitempty"`
+
+	Score     int `json:"score"`
+	VoteCount int `json:"vote_count"`
+	// MyVote is the requesting voter's own vote (-1 or 1) on this comment,
+	// if any. It is never persisted with the comment; Service populates it
+	// per-request from comment_votes when a voter key is supplied.
+	MyVote *int8 `json:"my_vote,omitempty"`
+
+	// TotalDescendants is the full count of this comment's descendants,
+	// regardless of MaxDepth/ChildrenPerNode bounds. Only populated on the
+	// root comment of a GetComments call.
+	TotalDescendants int `json:"total_descendants,omitempty"`
+	// HasMore is true when this comment has more children than were
+	// fetched (because of ChildrenPerNode or MaxDepth). NextCursor, if set,
+	// fetches the rest via GET /comments/:id/children.
+	HasMore    bool   `json:"has_more,omitempty"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// GetCommentsOptions bounds a GetComments subtree fetch so a huge thread
+// doesn't get materialized in full on every request. Children at each level
+// are always ordered by path ascending, a stable order, so cursors stay
+// valid across requests.
+type GetCommentsOptions struct {
+	// MaxDepth caps how many levels below the root are fetched. <= 0 means
+	// unbounded.
+	MaxDepth int
+	// ChildrenPerNode caps how many children of each parent are fetched.
+	// <= 0 means unbounded.
+	ChildrenPerNode int
+	// VoterKey, if set, populates MyVote on every returned comment.
+	VoterKey string
+}
+
+// ChildrenPage is a page of a single comment's children, for fetching
+// siblings beyond what GetComments's ChildrenPerNode bound returned.
+type ChildrenPage struct {
+	Comments   []*Comment `json:"comments"`
+	NextCursor string     `json:"next_cursor,omitempty"`
+	HasMore    bool       `json:"has_more"`
+}
+
+// Moderation status values for Comment.Status.
+const (
+	StatusPending int8 = iota
+	StatusApproved
+	StatusRejected
+)
+
+// SearchOptions controls a full-text search lookup performed by
+// Repository.SearchByText.
+type SearchOptions struct {
+	Limit  int
+	Offset int
+	// MinRank filters out matches below this ts_rank_cd score.
+	MinRank float64
+	// DateFrom/DateTo restrict results to comments created within range when set.
+	DateFrom *time.Time
+	DateTo   *time.Time
+	// PathPrefix restricts results to descendants of a given comment path.
+	PathPrefix string
 }
 
 type PaginatedComments struct {
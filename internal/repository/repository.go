@@ -9,12 +9,15 @@ import (
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/lib/pq"
 	"github.com/wb-go/wbf/dbpg"
 	"github.com/wb-go/wbf/retry"
 	"go.uber.org/zap"
+	"math"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -23,14 +26,164 @@ type Repository struct {
 	log *zap.Logger
 }
 
+// commentColumns is the full column list shared by every query that returns
+// whole Comment rows, so status/moderation columns stay in sync with
+// scanComment.
+const commentColumns = "id,parent_id,path_id,path,comment,created_at,status,ip,moderated_by,moderated_at,remote_actor_url,remote_object_url,score,vote_count"
+const subtreeColumns = "c.id,c.parent_id,c.path_id,c.path,c.comment,c.created_at,c.status,c.ip,c.moderated_by,c.moderated_at,c.remote_actor_url,c.remote_object_url,c.score,c.vote_count"
+const rankedColumns = "ranked.id,ranked.parent_id,ranked.path_id,ranked.path,ranked.comment,ranked.created_at,ranked.status,ranked.ip,ranked.moderated_by,ranked.moderated_at,ranked.remote_actor_url,ranked.remote_object_url,ranked.score,ranked.vote_count"
+
+// approvedStatus is models.StatusApproved inlined as a SQL literal so the
+// approved-only query variants below can stay plain string constants.
+const approvedStatus = "1"
+
 const (
-	createQuery                = `INSERT INTO comments (parent_id,path_id,path,comment,created_at) VALUES ($1,$2,$3,$4,$5)`
-	getPathQuery               = `SELECT path FROM comments WHERE id = $1`
-	getCommentByIDQuery        = `SELECT id,parent_id,path_id,path,comment,created_at FROM comments WHERE id = $1`
-	getChildrenByPathQuery     = `SELECT id,parent_id,path_id,path,comment,created_at FROM comments WHERE path LIKE $1 ORDER BY path DESC`
-	deleteCommentQuery         = `DELETE FROM comments WHERE path LIKE $1`
-	countTopLevelCommentsQuery = `SELECT COUNT(*) FROM comments WHERE parent_id IS NULL`
-	searchCommentsQuery        = `SELECT id, parent_id, path_id, path, comment, created_at FROM comments WHERE comment ILIKE $1 ORDER BY created_at DESC LIMIT 50`
+	createQuery = `
+		INSERT INTO comments (parent_id,path_id,path,comment,created_at,status,ip,remote_actor_url,remote_object_url)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)`
+	getPathQuery                   = `SELECT path FROM comments WHERE id = $1`
+	getCommentByIDQuery            = `SELECT ` + commentColumns + ` FROM comments WHERE id = $1`
+	getByPathIDQuery               = `SELECT ` + commentColumns + ` FROM comments WHERE path_id = $1`
+	getByRemoteObjectURLQuery      = `SELECT ` + commentColumns + ` FROM comments WHERE remote_object_url = $1`
+	getChildrenByPathQuery         = `SELECT ` + commentColumns + ` FROM comments WHERE path LIKE $1 ORDER BY path DESC`
+	getChildrenByPathApprovedQuery = `SELECT ` + commentColumns + ` FROM comments WHERE path LIKE $1 AND status = ` + approvedStatus + ` ORDER BY path DESC`
+	deleteCommentQuery             = `DELETE FROM comments WHERE path LIKE $1`
+	countTopLevelCommentsQuery     = `SELECT COUNT(*) FROM comments WHERE parent_id IS NULL`
+	countTopLevelApprovedQuery     = `SELECT COUNT(*) FROM comments WHERE parent_id IS NULL AND status = ` + approvedStatus
+	getSubtreesByPathsQuery        = `
+		SELECT ` + subtreeColumns + `
+		FROM comments c
+		JOIN unnest($1::text[]) AS root(pattern) ON c.path LIKE root.pattern
+		ORDER BY c.path`
+	getSubtreesByPathsApprovedQuery = `
+		SELECT ` + subtreeColumns + `
+		FROM comments c
+		JOIN unnest($1::text[]) AS root(pattern) ON c.path LIKE root.pattern
+		WHERE c.status = ` + approvedStatus + `
+		ORDER BY c.path`
+	setStatusQuery = `
+		UPDATE comments SET status = $1, moderated_by = $2, moderated_at = $3
+		WHERE id = $4
+		RETURNING ` + commentColumns
+	listByStatusQuery = `
+		SELECT ` + commentColumns + ` FROM comments
+		WHERE status = $1
+		ORDER BY created_at DESC
+		LIMIT $2 OFFSET $3`
+	countByStatusQuery = `SELECT COUNT(*) FROM comments WHERE status = $1`
+	searchFTSQuery     = `
+		SELECT id, parent_id, path_id, path, comment, created_at, rank, highlight FROM (
+			SELECT c.id, c.parent_id, c.path_id, c.path, c.comment, c.created_at,
+			       ts_rank_cd(c.search_vector, websearch_to_tsquery($1::regconfig, $2)) AS rank,
+			       ts_headline($1::regconfig, c.comment, websearch_to_tsquery($1::regconfig, $2)) AS highlight
+			FROM comments c
+			WHERE c.search_vector @@ websearch_to_tsquery($1::regconfig, $2)
+			  AND ($3::timestamptz IS NULL OR c.created_at >= $3)
+			  AND ($4::timestamptz IS NULL OR c.created_at <= $4)
+			  AND ($5::text IS NULL OR c.path LIKE $5)
+		) matched
+		WHERE rank >= $6
+		ORDER BY rank DESC
+		LIMIT $7 OFFSET $8`
+	searchFTSCountQuery = `
+		SELECT COUNT(*) FROM (
+			SELECT ts_rank_cd(c.search_vector, websearch_to_tsquery($1::regconfig, $2)) AS rank
+			FROM comments c
+			WHERE c.search_vector @@ websearch_to_tsquery($1::regconfig, $2)
+			  AND ($3::timestamptz IS NULL OR c.created_at >= $3)
+			  AND ($4::timestamptz IS NULL OR c.created_at <= $4)
+			  AND ($5::text IS NULL OR c.path LIKE $5)
+		) matched
+		WHERE rank >= $6`
+	searchTrigramQuery = `
+		SELECT id, parent_id, path_id, path, comment, created_at, similarity(comment, $1) AS rank, '' AS highlight
+		FROM comments
+		WHERE comment % $1
+		  AND ($2::timestamptz IS NULL OR created_at >= $2)
+		  AND ($3::timestamptz IS NULL OR created_at <= $3)
+		  AND ($4::text IS NULL OR path LIKE $4)
+		ORDER BY rank DESC
+		LIMIT $5 OFFSET $6`
+	searchTrigramCountQuery = `
+		SELECT COUNT(*) FROM comments
+		WHERE comment % $1
+		  AND ($2::timestamptz IS NULL OR created_at >= $2)
+		  AND ($3::timestamptz IS NULL OR created_at <= $3)
+		  AND ($4::text IS NULL OR path LIKE $4)`
+	listFollowerInboxesQuery = `SELECT inbox_url FROM activitypub_followers`
+	upsertFollowerQuery      = `
+		INSERT INTO activitypub_followers (actor_url, inbox_url)
+		VALUES ($1, $2)
+		ON CONFLICT (actor_url) DO UPDATE SET inbox_url = EXCLUDED.inbox_url`
+	deleteFollowerQuery = `DELETE FROM activitypub_followers WHERE actor_url = $1`
+	upsertVoteQuery     = `
+		INSERT INTO comment_votes (comment_id, voter_key, value)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (comment_id, voter_key) DO UPDATE SET value = EXCLUDED.value`
+	deleteVoteQuery     = `DELETE FROM comment_votes WHERE comment_id = $1 AND voter_key = $2`
+	recomputeScoreQuery = `
+		UPDATE comments SET
+			score = COALESCE((SELECT SUM(value) FROM comment_votes WHERE comment_id = $1), 0),
+			vote_count = COALESCE((SELECT COUNT(*) FROM comment_votes WHERE comment_id = $1), 0)
+		WHERE id = $1
+		RETURNING score, vote_count`
+	getVotesByVoterQuery = `
+		SELECT comment_id, value FROM comment_votes
+		WHERE voter_key = $1 AND comment_id = ANY($2::bigint[])`
+	countDescendantsQuery         = `SELECT COUNT(*) FROM comments WHERE path LIKE $1 AND id != $2`
+	countDescendantsApprovedQuery = `SELECT COUNT(*) FROM comments WHERE path LIKE $1 AND id != $2 AND status = ` + approvedStatus
+	countChildrenByParentsQuery   = `
+		SELECT parent_id, COUNT(*) FROM comments
+		WHERE parent_id = ANY($1::bigint[]) AND status = ` + approvedStatus + `
+		GROUP BY parent_id`
+	childrenPageQuery = `
+		SELECT ` + commentColumns + ` FROM comments
+		WHERE parent_id = $1 AND status = ` + approvedStatus + ` AND ($2 = '' OR path > $2)
+		ORDER BY path
+		LIMIT $3`
+)
+
+// boundedSubtreeQueryTemplate fetches a root comment plus its descendants
+// via a recursive CTE that caps recursion at maxDepth levels and, at every
+// level, keeps only the first childrenPerNode children of each parent
+// (ranked by path ascending, a stable order). Unlike
+// GetChildrenByPath it must be formatted per call since the "only approved"
+// filter lives inside the windowed subquery, not a trailing WHERE clause.
+const boundedSubtreeQueryTemplate = `
+	WITH RECURSIVE bounded_subtree AS (
+		SELECT ` + commentColumns + `, 0 AS depth
+		FROM comments
+		WHERE id = $1
+
+		UNION ALL
+
+		SELECT ` + rankedColumns + `, bounded_subtree.depth + 1
+		FROM bounded_subtree
+		JOIN (
+			SELECT c.*, ROW_NUMBER() OVER (PARTITION BY c.parent_id ORDER BY c.path) AS rn
+			FROM comments c
+			%s
+		) ranked ON ranked.parent_id = bounded_subtree.id
+		WHERE ranked.rn <= $2
+		  AND bounded_subtree.depth < $3
+	)
+	SELECT ` + commentColumns + ` FROM bounded_subtree ORDER BY path`
+
+// subtreeAssemblyWorkers bounds the concurrency used when grouping a batch
+// of rows fetched by GetSubtreesByPaths back into per-root slices.
+const subtreeAssemblyWorkers = 8
+
+// defaultSearchLanguage is the text-search configuration the generated
+// search_vector column is built with ('simple', which doesn't stem or drop
+// stopwords). The query side must use the same configuration: a
+// language-specific tsquery (e.g. "english") stems its lexemes, which then
+// mostly fail to match the unstemmed 'simple' vector, so this isn't
+// currently exposed as a per-request option.
+const defaultSearchLanguage = "simple"
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
 )
 
 var (
@@ -63,6 +216,21 @@ func NewRepository(masterDSN string, slaveDSNs []string, log *zap.Logger) (*Repo
 	return &Repository{db: db, log: log.Named("repository")}, nil
 }
 
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanComment scans a row produced by a query selecting commentColumns (or
+// subtreeColumns) into a Comment.
+func scanComment(s rowScanner) (*models.Comment, error) {
+	var c models.Comment
+	if err := s.Scan(&c.ID, &c.ParentID, &c.PathID, &c.Path, &c.Comm, &c.CreatedAt, &c.Status, &c.IP, &c.ModeratedBy, &c.ModeratedAt, &c.RemoteActorURL, &c.RemoteObjectURL, &c.Score, &c.VoteCount); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
 func (r *Repository) Create(ctx context.Context, c models.Comment) (int64, error) {
 	var parentPath string
 
@@ -85,7 +253,7 @@ func (r *Repository) Create(ctx context.Context, c models.Comment) (int64, error
 
 	newPath := parentPath + c.PathID + "/"
 
-	res, err := r.db.ExecWithRetry(ctx, retryStrategy, createQuery, c.ParentID, c.PathID, newPath, c.Comm, c.CreatedAt)
+	res, err := r.db.ExecWithRetry(ctx, retryStrategy, createQuery, c.ParentID, c.PathID, newPath, c.Comm, c.CreatedAt, c.Status, c.IP, c.RemoteActorURL, c.RemoteObjectURL)
 	if err != nil {
 		r.log.Error("Failed to create comment in DB", zap.Error(err))
 		return -1, fmt.Errorf("failed to create comment: %w", err)
@@ -99,25 +267,94 @@ func (r *Repository) Create(ctx context.Context, c models.Comment) (int64, error
 }
 
 func (r *Repository) GetByID(ctx context.Context, id int64) (*models.Comment, error) {
-	var comments models.Comment
-
 	row, err := r.db.QueryRowWithRetry(ctx, retryStrategy, getCommentByIDQuery, id)
 	if err != nil {
 		r.log.Error("Failed to get comment by ID", zap.Int64("id", id), zap.Error(err))
 		return nil, fmt.Errorf("failed to get comment by ID: %w", err)
 	}
-	if err := row.Scan(&comments.ID, &comments.ParentID, &comments.PathID, &comments.Path, &comments.Comm, &comments.CreatedAt); err != nil {
+	comment, err := scanComment(row)
+	if err != nil {
 		r.log.Error("Failed to scan comment by ID", zap.Int64("id", id), zap.Error(err))
 		return nil, fmt.Errorf("failed to get comment by ID: %w", err)
 	}
 
-	return &comments, nil
+	return comment, nil
 }
 
-func (r *Repository) GetChildrenByPath(ctx context.Context, path string) ([]*models.Comment, error) {
+// GetByPathID looks up a comment by its public path_id, which is how
+// ActivityPub Note/inReplyTo URLs address comments.
+func (r *Repository) GetByPathID(ctx context.Context, pathID string) (*models.Comment, error) {
+	row, err := r.db.QueryRowWithRetry(ctx, retryStrategy, getByPathIDQuery, pathID)
+	if err != nil {
+		r.log.Error("Failed to get comment by path_id", zap.String("path_id", pathID), zap.Error(err))
+		return nil, fmt.Errorf("failed to get comment by path_id: %w", err)
+	}
+	comment, err := scanComment(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		r.log.Error("Failed to scan comment by path_id", zap.Error(err))
+		return nil, fmt.Errorf("failed to scan comment by path_id: %w", err)
+	}
+	return comment, nil
+}
+
+// GetByRemoteObjectURL looks up a comment previously created from a federated
+// Create{Note} activity, so inbox delivery can be treated idempotently.
+func (r *Repository) GetByRemoteObjectURL(ctx context.Context, objectURL string) (*models.Comment, error) {
+	row, err := r.db.QueryRowWithRetry(ctx, retryStrategy, getByRemoteObjectURLQuery, objectURL)
+	if err != nil {
+		r.log.Error("Failed to get comment by remote object URL", zap.Error(err))
+		return nil, fmt.Errorf("failed to get comment by remote object URL: %w", err)
+	}
+	comment, err := scanComment(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		r.log.Error("Failed to scan comment by remote object URL", zap.Error(err))
+		return nil, fmt.Errorf("failed to scan comment by remote object URL: %w", err)
+	}
+	return comment, nil
+}
+
+// childrenSortColumns maps the sortBy values GetChildrenByPath accepts for
+// score-based ordering to the column they sort on. Any other sortBy keeps
+// the original fixed "path DESC" ordering used to lay descendants out for
+// tree assembly.
+var childrenSortColumns = map[string]string{
+	"score": "score",
+	"hot":   "hot_rank",
+}
+
+// GetChildrenByPath returns every descendant of path. When approvedOnly is
+// true (the public read path) pending and rejected comments are filtered
+// out; admin callers pass false to see the full subtree. sortBy selects
+// "score" or "hot" ordering for the returned replies; any other value (or
+// "") keeps the default path-based ordering.
+func (r *Repository) GetChildrenByPath(ctx context.Context, path string, approvedOnly bool, sortBy, sortOrder string) ([]*models.Comment, error) {
 	likePath := path + "%"
-	rows, err := r.db.QueryWithRetry(ctx, retryStrategy, getChildrenByPathQuery, likePath)
 
+	var query string
+	if column, ok := childrenSortColumns[sortBy]; ok {
+		order := strings.ToUpper(sortOrder)
+		if order != "ASC" && order != "DESC" {
+			order = "DESC"
+		}
+		where := "WHERE path LIKE $1"
+		if approvedOnly {
+			where += " AND status = " + approvedStatus
+		}
+		query = fmt.Sprintf(`SELECT %s FROM comments %s ORDER BY %s %s`, commentColumns, where, column, order)
+	} else {
+		query = getChildrenByPathQuery
+		if approvedOnly {
+			query = getChildrenByPathApprovedQuery
+		}
+	}
+
+	rows, err := r.db.QueryWithRetry(ctx, retryStrategy, query, likePath)
 	if err != nil {
 		r.log.Error("Failed to get children by path", zap.String("path", path), zap.Error(err))
 		return nil, fmt.Errorf("failed to get children by path: %w", err)
@@ -125,16 +362,118 @@ func (r *Repository) GetChildrenByPath(ctx context.Context, path string) ([]*mod
 	defer rows.Close()
 	var comments []*models.Comment
 	for rows.Next() {
-		var comment models.Comment
-		if err := rows.Scan(&comment.ID, &comment.ParentID, &comment.PathID, &comment.Path, &comment.Comm, &comment.CreatedAt); err != nil {
+		comment, err := scanComment(rows)
+		if err != nil {
 			r.log.Error("Failed to scan children by path", zap.String("path", path), zap.Error(err))
 			return nil, fmt.Errorf("failed to get children by path: %w", err)
 		}
-		comments = append(comments, &comment)
+		comments = append(comments, comment)
 	}
 	return comments, nil
 }
 
+// GetSubtreesByPaths fetches all descendants for a page of root paths in a
+// single round-trip and groups them by the root path they belong to. This
+// replaces issuing one GetChildrenByPath query per root, which turns listing
+// a page of top-level comments into an N+1 query pattern.
+func (r *Repository) GetSubtreesByPaths(ctx context.Context, paths []string, approvedOnly bool) (map[string][]*models.Comment, error) {
+	if len(paths) == 0 {
+		return map[string][]*models.Comment{}, nil
+	}
+
+	patterns := make([]string, len(paths))
+	for i, path := range paths {
+		patterns[i] = path + "%"
+	}
+
+	query := getSubtreesByPathsQuery
+	if approvedOnly {
+		query = getSubtreesByPathsApprovedQuery
+	}
+
+	rows, err := r.db.QueryWithRetry(ctx, retryStrategy, query, pq.Array(patterns))
+	if err != nil {
+		r.log.Error("Failed to get subtrees by paths", zap.Int("roots", len(paths)), zap.Error(err))
+		return nil, fmt.Errorf("failed to get subtrees by paths: %w", err)
+	}
+	defer rows.Close()
+
+	var flat []*models.Comment
+	for rows.Next() {
+		comment, err := scanComment(rows)
+		if err != nil {
+			r.log.Error("Failed to scan subtree comment", zap.Error(err))
+			return nil, fmt.Errorf("failed to scan subtree comment: %w", err)
+		}
+		flat = append(flat, comment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate subtree rows: %w", err)
+	}
+
+	return groupCommentsByRootPath(paths, flat), nil
+}
+
+// groupCommentsByRootPath assigns each comment to the root path it descends
+// from. It fans the assignment out across a bounded worker pool since, at a
+// page size of 100, matching rows against roots is the dominant in-process
+// cost of GetSubtreesByPaths.
+func groupCommentsByRootPath(paths []string, flat []*models.Comment) map[string][]*models.Comment {
+	result := make(map[string][]*models.Comment, len(paths))
+	for _, path := range paths {
+		result[path] = nil
+	}
+	if len(flat) == 0 {
+		return result
+	}
+
+	workers := subtreeAssemblyWorkers
+	if workers > len(flat) {
+		workers = len(flat)
+	}
+
+	type match struct {
+		rootPath string
+		comment  *models.Comment
+	}
+	matches := make([]match, len(flat))
+
+	var wg sync.WaitGroup
+	chunk := (len(flat) + workers - 1) / workers
+	for w := 0; w < workers; w++ {
+		start := w * chunk
+		end := start + chunk
+		if start >= len(flat) {
+			break
+		}
+		if end > len(flat) {
+			end = len(flat)
+		}
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			for i := start; i < end; i++ {
+				comment := flat[i]
+				for _, path := range paths {
+					if strings.HasPrefix(comment.Path, path) {
+						matches[i] = match{rootPath: path, comment: comment}
+						break
+					}
+				}
+			}
+		}(start, end)
+	}
+	wg.Wait()
+
+	for _, m := range matches {
+		if m.comment == nil {
+			continue
+		}
+		result[m.rootPath] = append(result[m.rootPath], m.comment)
+	}
+	return result
+}
+
 func (r *Repository) DeleteByPath(ctx context.Context, path string) error {
 
 	likePath := path + "%"
@@ -148,9 +487,17 @@ func (r *Repository) DeleteByPath(ctx context.Context, path string) error {
 	return nil
 }
 
-func (r *Repository) GetTopLevelComments(ctx context.Context, limit, offset int, sortBy, sortOrder string) ([]*models.Comment, int, error) {
+// GetTopLevelComments returns a page of root comments. When approvedOnly is
+// true (the public read path) pending and rejected comments are excluded
+// from both the page and the total count.
+func (r *Repository) GetTopLevelComments(ctx context.Context, limit, offset int, sortBy, sortOrder string, approvedOnly bool) ([]*models.Comment, int, error) {
+	countQuery := countTopLevelCommentsQuery
+	if approvedOnly {
+		countQuery = countTopLevelApprovedQuery
+	}
+
 	var total int
-	row, err := r.db.QueryRowWithRetry(ctx, retryStrategy, countTopLevelCommentsQuery)
+	row, err := r.db.QueryRowWithRetry(ctx, retryStrategy, countQuery)
 	if err != nil {
 		r.log.Error("Failed to get top level comments", zap.Error(err))
 		return nil, 0, fmt.Errorf("failed to get top level comments: %w", err)
@@ -160,16 +507,21 @@ func (r *Repository) GetTopLevelComments(ctx context.Context, limit, offset int,
 		return nil, 0, fmt.Errorf("failed to count top level comments: %w", err)
 	}
 
-	allowedSorts := map[string]bool{"created_at": true, "id": true}
-	if !allowedSorts[sortBy] {
-		sortBy = "created_at"
+	allowedSorts := map[string]string{"created_at": "created_at", "id": "id", "score": "score", "hot": "hot_rank"}
+	sortColumn, ok := allowedSorts[sortBy]
+	if !ok {
+		sortColumn = "created_at"
 	}
 	sortOrder = strings.ToUpper(sortOrder)
 	if sortOrder != "ASC" && sortOrder != "DESC" {
 		sortOrder = "ASC"
 	}
 
-	query := fmt.Sprintf(`SELECT id,parent_id,path_id,path,comment,created_at FROM comments WHERE parent_id IS NULL ORDER BY %s %s LIMIT $1 OFFSET $2`, sortBy, sortOrder)
+	where := "WHERE parent_id IS NULL"
+	if approvedOnly {
+		where += " AND status = " + approvedStatus
+	}
+	query := fmt.Sprintf(`SELECT %s FROM comments %s ORDER BY %s %s LIMIT $1 OFFSET $2`, commentColumns, where, sortColumn, sortOrder)
 
 	rows, err := r.db.QueryWithRetry(ctx, retryStrategy, query, limit, offset)
 	if err != nil {
@@ -180,35 +532,397 @@ func (r *Repository) GetTopLevelComments(ctx context.Context, limit, offset int,
 
 	var comments []*models.Comment
 	for rows.Next() {
-		var comment models.Comment
-		if err := rows.Scan(&comment.ID, &comment.ParentID, &comment.PathID, &comment.Path, &comment.Comm, &comment.CreatedAt); err != nil {
+		comment, err := scanComment(rows)
+		if err != nil {
 			r.log.Error("Failed to scan top level comment", zap.Error(err))
 			return nil, 0, fmt.Errorf("failed to scan top level comment: %w", err)
 		}
-		comments = append(comments, &comment)
+		comments = append(comments, comment)
 	}
 	return comments, total, nil
 }
 
-func (r *Repository) SearchByText(ctx context.Context, query string) ([]*models.Comment, error) {
-	searchPattern := "%" + query + "%"
+// ListByStatus returns comments awaiting or having received a moderation
+// decision, newest first, for the admin moderation queue.
+func (r *Repository) ListByStatus(ctx context.Context, status int8, limit, offset int) ([]*models.Comment, int, error) {
+	var total int
+	row, err := r.db.QueryRowWithRetry(ctx, retryStrategy, countByStatusQuery, status)
+	if err != nil {
+		r.log.Error("Failed to count comments by status", zap.Int8("status", status), zap.Error(err))
+		return nil, 0, fmt.Errorf("failed to count comments by status: %w", err)
+	}
+	if err := row.Scan(&total); err != nil {
+		r.log.Error("Failed to scan comment status count", zap.Error(err))
+		return nil, 0, fmt.Errorf("failed to scan comment status count: %w", err)
+	}
 
-	rows, err := r.db.QueryWithRetry(ctx, retryStrategy, searchCommentsQuery, searchPattern)
+	rows, err := r.db.QueryWithRetry(ctx, retryStrategy, listByStatusQuery, status, limit, offset)
 	if err != nil {
-		r.log.Error("Failed to search comments with LIKE", zap.String("query", query), zap.Error(err))
-		return nil, fmt.Errorf("failed to search comments: %w", err)
+		r.log.Error("Failed to list comments by status", zap.Int8("status", status), zap.Error(err))
+		return nil, 0, fmt.Errorf("failed to list comments by status: %w", err)
 	}
 	defer rows.Close()
 
+	var comments []*models.Comment
+	for rows.Next() {
+		comment, err := scanComment(rows)
+		if err != nil {
+			r.log.Error("Failed to scan comment by status", zap.Error(err))
+			return nil, 0, fmt.Errorf("failed to scan comment by status: %w", err)
+		}
+		comments = append(comments, comment)
+	}
+	return comments, total, nil
+}
+
+// SetStatus records a moderation decision and returns the updated comment.
+func (r *Repository) SetStatus(ctx context.Context, id int64, status int8, moderatedBy int64, moderatedAt time.Time) (*models.Comment, error) {
+	row, err := r.db.QueryRowWithRetry(ctx, retryStrategy, setStatusQuery, status, moderatedBy, moderatedAt, id)
+	if err != nil {
+		r.log.Error("Failed to set comment status", zap.Int64("id", id), zap.Error(err))
+		return nil, fmt.Errorf("failed to set comment status: %w", err)
+	}
+	comment, err := scanComment(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("comment with id %d not found", id)
+		}
+		r.log.Error("Failed to scan updated comment", zap.Error(err))
+		return nil, fmt.Errorf("failed to scan updated comment: %w", err)
+	}
+	return comment, nil
+}
+
+// SearchByText runs a ranked full-text search over comments using
+// websearch_to_tsquery against the generated search_vector
+// column, returning results ordered by ts_rank_cd along with the total match
+// count for pagination. When the tsquery yields no hits (e.g. for very short
+// or heavily misspelled queries) it falls back to a pg_trgm similarity match
+// so partial-word search still works.
+func (r *Repository) SearchByText(ctx context.Context, query string, opts models.SearchOptions) ([]*models.Comment, int, error) {
+	limit := opts.Limit
+	if limit <= 0 || limit > maxSearchLimit {
+		limit = defaultSearchLimit
+	}
+
+	var pathPattern interface{}
+	if opts.PathPrefix != "" {
+		pathPattern = opts.PathPrefix + "%"
+	}
+
+	comments, total, err := r.searchFTS(ctx, query, defaultSearchLanguage, opts, limit, pathPattern)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(comments) > 0 {
+		return comments, total, nil
+	}
+
+	r.log.Debug("Full-text search returned no hits, falling back to trigram match", zap.String("query", query))
+	return r.searchTrigram(ctx, query, opts, limit, pathPattern)
+}
+
+func (r *Repository) searchFTS(ctx context.Context, query, lang string, opts models.SearchOptions, limit int, pathPattern interface{}) ([]*models.Comment, int, error) {
+	var total int
+	row, err := r.db.QueryRowWithRetry(ctx, retryStrategy, searchFTSCountQuery, lang, query, opts.DateFrom, opts.DateTo, pathPattern, opts.MinRank)
+	if err != nil {
+		r.log.Error("Failed to count full-text search results", zap.String("query", query), zap.Error(err))
+		return nil, 0, fmt.Errorf("failed to count search results: %w", err)
+	}
+	if err := row.Scan(&total); err != nil {
+		r.log.Error("Failed to scan full-text search count", zap.Error(err))
+		return nil, 0, fmt.Errorf("failed to scan search count: %w", err)
+	}
+
+	rows, err := r.db.QueryWithRetry(ctx, retryStrategy, searchFTSQuery, lang, query, opts.DateFrom, opts.DateTo, pathPattern, opts.MinRank, limit, opts.Offset)
+	if err != nil {
+		r.log.Error("Failed to search comments with full-text search", zap.String("query", query), zap.Error(err))
+		return nil, 0, fmt.Errorf("failed to search comments: %w", err)
+	}
+	defer rows.Close()
+
+	comments, err := scanSearchRows(rows)
+	if err != nil {
+		return nil, 0, err
+	}
+	return comments, total, nil
+}
+
+func (r *Repository) searchTrigram(ctx context.Context, query string, opts models.SearchOptions, limit int, pathPattern interface{}) ([]*models.Comment, int, error) {
+	var total int
+	row, err := r.db.QueryRowWithRetry(ctx, retryStrategy, searchTrigramCountQuery, query, opts.DateFrom, opts.DateTo, pathPattern)
+	if err != nil {
+		r.log.Error("Failed to count trigram search results", zap.String("query", query), zap.Error(err))
+		return nil, 0, fmt.Errorf("failed to count search results: %w", err)
+	}
+	if err := row.Scan(&total); err != nil {
+		r.log.Error("Failed to scan trigram search count", zap.Error(err))
+		return nil, 0, fmt.Errorf("failed to scan search count: %w", err)
+	}
+
+	rows, err := r.db.QueryWithRetry(ctx, retryStrategy, searchTrigramQuery, query, opts.DateFrom, opts.DateTo, pathPattern, limit, opts.Offset)
+	if err != nil {
+		r.log.Error("Failed to search comments with trigram match", zap.String("query", query), zap.Error(err))
+		return nil, 0, fmt.Errorf("failed to search comments: %w", err)
+	}
+	defer rows.Close()
+
+	comments, err := scanSearchRows(rows)
+	if err != nil {
+		return nil, 0, err
+	}
+	return comments, total, nil
+}
+
+func scanSearchRows(rows *sql.Rows) ([]*models.Comment, error) {
 	var comments []*models.Comment
 	for rows.Next() {
 		var comment models.Comment
-		if err := rows.Scan(&comment.ID, &comment.ParentID, &comment.PathID, &comment.Path, &comment.Comm, &comment.CreatedAt); err != nil {
-			r.log.Error("Failed to scan searched comment", zap.Error(err))
+		var rank float64
+		if err := rows.Scan(&comment.ID, &comment.ParentID, &comment.PathID, &comment.Path, &comment.Comm, &comment.CreatedAt, &rank, &comment.Highlight); err != nil {
 			return nil, fmt.Errorf("failed to scan searched comment: %w", err)
 		}
 		comments = append(comments, &comment)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate search rows: %w", err)
+	}
+	return comments, nil
+}
+
+// ListFollowerInboxes returns the inbox URL of every known ActivityPub
+// follower, for fanning out a Create{Note} activity on the outbound side.
+func (r *Repository) ListFollowerInboxes(ctx context.Context) ([]string, error) {
+	rows, err := r.db.QueryWithRetry(ctx, retryStrategy, listFollowerInboxesQuery)
+	if err != nil {
+		r.log.Error("Failed to list follower inboxes", zap.Error(err))
+		return nil, fmt.Errorf("failed to list follower inboxes: %w", err)
+	}
+	defer rows.Close()
+
+	var inboxes []string
+	for rows.Next() {
+		var inbox string
+		if err := rows.Scan(&inbox); err != nil {
+			r.log.Error("Failed to scan follower inbox", zap.Error(err))
+			return nil, fmt.Errorf("failed to scan follower inbox: %w", err)
+		}
+		inboxes = append(inboxes, inbox)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate follower inboxes: %w", err)
+	}
+	return inboxes, nil
+}
+
+// AddFollower records actorURL as following us, with inboxURL as where its
+// Create{Note} deliveries should land. It's idempotent on actorURL, so a
+// repeated Follow just refreshes the stored inbox.
+func (r *Repository) AddFollower(ctx context.Context, actorURL, inboxURL string) error {
+	if _, err := r.db.ExecWithRetry(ctx, retryStrategy, upsertFollowerQuery, actorURL, inboxURL); err != nil {
+		r.log.Error("Failed to add follower", zap.String("actor_url", actorURL), zap.Error(err))
+		return fmt.Errorf("failed to add follower: %w", err)
+	}
+	return nil
+}
+
+// RemoveFollower deletes actorURL from the follower list, in response to an
+// Undo{Follow}.
+func (r *Repository) RemoveFollower(ctx context.Context, actorURL string) error {
+	if _, err := r.db.ExecWithRetry(ctx, retryStrategy, deleteFollowerQuery, actorURL); err != nil {
+		r.log.Error("Failed to remove follower", zap.String("actor_url", actorURL), zap.Error(err))
+		return fmt.Errorf("failed to remove follower: %w", err)
+	}
+	return nil
+}
+
+// Vote records voterKey's vote on a comment, replacing any earlier vote by
+// the same voter, and returns the comment's updated score and vote count.
+func (r *Repository) Vote(ctx context.Context, commentID int64, voterKey string, value int8) (int, int, error) {
+	if _, err := r.db.ExecWithRetry(ctx, retryStrategy, upsertVoteQuery, commentID, voterKey, value); err != nil {
+		r.log.Error("Failed to record vote", zap.Int64("comment_id", commentID), zap.Error(err))
+		return 0, 0, fmt.Errorf("failed to record vote: %w", err)
+	}
+	return r.recomputeScore(ctx, commentID)
+}
+
+// Unvote removes voterKey's vote on a comment, if any, and returns the
+// comment's updated score and vote count.
+func (r *Repository) Unvote(ctx context.Context, commentID int64, voterKey string) (int, int, error) {
+	if _, err := r.db.ExecWithRetry(ctx, retryStrategy, deleteVoteQuery, commentID, voterKey); err != nil {
+		r.log.Error("Failed to remove vote", zap.Int64("comment_id", commentID), zap.Error(err))
+		return 0, 0, fmt.Errorf("failed to remove vote: %w", err)
+	}
+	return r.recomputeScore(ctx, commentID)
+}
+
+func (r *Repository) recomputeScore(ctx context.Context, commentID int64) (int, int, error) {
+	row, err := r.db.QueryRowWithRetry(ctx, retryStrategy, recomputeScoreQuery, commentID)
+	if err != nil {
+		r.log.Error("Failed to recompute comment score", zap.Int64("comment_id", commentID), zap.Error(err))
+		return 0, 0, fmt.Errorf("failed to recompute comment score: %w", err)
+	}
+	var score, voteCount int
+	if err := row.Scan(&score, &voteCount); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, 0, fmt.Errorf("comment with id %d not found", commentID)
+		}
+		r.log.Error("Failed to scan recomputed comment score", zap.Error(err))
+		return 0, 0, fmt.Errorf("failed to scan recomputed comment score: %w", err)
+	}
+	return score, voteCount, nil
+}
+
+// GetVotesByVoter returns voterKey's vote on each of commentIDs that it has
+// actually voted on, keyed by comment ID.
+func (r *Repository) GetVotesByVoter(ctx context.Context, voterKey string, commentIDs []int64) (map[int64]int8, error) {
+	if len(commentIDs) == 0 {
+		return map[int64]int8{}, nil
+	}
+
+	rows, err := r.db.QueryWithRetry(ctx, retryStrategy, getVotesByVoterQuery, voterKey, pq.Array(commentIDs))
+	if err != nil {
+		r.log.Error("Failed to get votes by voter", zap.Error(err))
+		return nil, fmt.Errorf("failed to get votes by voter: %w", err)
+	}
+	defer rows.Close()
+
+	votes := make(map[int64]int8, len(commentIDs))
+	for rows.Next() {
+		var commentID int64
+		var value int8
+		if err := rows.Scan(&commentID, &value); err != nil {
+			r.log.Error("Failed to scan vote", zap.Error(err))
+			return nil, fmt.Errorf("failed to scan vote: %w", err)
+		}
+		votes[commentID] = value
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate votes: %w", err)
+	}
+	return votes, nil
+}
+
+// GetBoundedSubtree returns rootID and its descendants, recursing at most
+// maxDepth levels and keeping at most childrenPerNode children per parent at
+// every level. maxDepth/childrenPerNode <= 0 are unbounded. Rows come back
+// ordered by path ascending; the root row is returned whatever its status,
+// and with approvedOnly descendants are reached only through approved
+// parents.
+func (r *Repository) GetBoundedSubtree(ctx context.Context, rootID int64, maxDepth, childrenPerNode int, approvedOnly bool) ([]*models.Comment, error) {
+	if maxDepth <= 0 {
+		maxDepth = math.MaxInt32
+	}
+	if childrenPerNode <= 0 {
+		childrenPerNode = math.MaxInt32
+	}
+
+	rankedWhere := ""
+	if approvedOnly {
+		rankedWhere = "WHERE c.status = " + approvedStatus
+	}
+	query := fmt.Sprintf(boundedSubtreeQueryTemplate, rankedWhere)
+
+	rows, err := r.db.QueryWithRetry(ctx, retryStrategy, query, rootID, childrenPerNode, maxDepth)
+	if err != nil {
+		r.log.Error("Failed to get bounded subtree", zap.Int64("root_id", rootID), zap.Error(err))
+		return nil, fmt.Errorf("failed to get bounded subtree: %w", err)
+	}
+	defer rows.Close()
+
+	var comments []*models.Comment
+	for rows.Next() {
+		comment, err := scanComment(rows)
+		if err != nil {
+			r.log.Error("Failed to scan bounded subtree comment", zap.Error(err))
+			return nil, fmt.Errorf("failed to scan bounded subtree comment: %w", err)
+		}
+		comments = append(comments, comment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate bounded subtree rows: %w", err)
+	}
+	return comments, nil
+}
+
+// CountDescendants counts every descendant of rootPath, ignoring any
+// MaxDepth/ChildrenPerNode bound, so callers can show "N replies" without
+// fetching them all. approvedOnly matches the filter GetBoundedSubtree was
+// called with, so the count matches what the bounded tree it annotates can
+// actually show.
+func (r *Repository) CountDescendants(ctx context.Context, rootPath string, rootID int64, approvedOnly bool) (int, error) {
+	query := countDescendantsQuery
+	if approvedOnly {
+		query = countDescendantsApprovedQuery
+	}
+	row, err := r.db.QueryRowWithRetry(ctx, retryStrategy, query, rootPath+"%", rootID)
+	if err != nil {
+		r.log.Error("Failed to count descendants", zap.String("path", rootPath), zap.Error(err))
+		return 0, fmt.Errorf("failed to count descendants: %w", err)
+	}
+	var total int
+	if err := row.Scan(&total); err != nil {
+		r.log.Error("Failed to scan descendant count", zap.Error(err))
+		return 0, fmt.Errorf("failed to scan descendant count: %w", err)
+	}
+	return total, nil
+}
+
+// CountChildrenByParents returns, for each of parentIDs, its total direct
+// child count (unbounded), so GetComments can tell whether a bounded fetch
+// left children out.
+func (r *Repository) CountChildrenByParents(ctx context.Context, parentIDs []int64) (map[int64]int, error) {
+	if len(parentIDs) == 0 {
+		return map[int64]int{}, nil
+	}
+
+	rows, err := r.db.QueryWithRetry(ctx, retryStrategy, countChildrenByParentsQuery, pq.Array(parentIDs))
+	if err != nil {
+		r.log.Error("Failed to count children by parents", zap.Error(err))
+		return nil, fmt.Errorf("failed to count children by parents: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[int64]int, len(parentIDs))
+	for rows.Next() {
+		var parentID int64
+		var count int
+		if err := rows.Scan(&parentID, &count); err != nil {
+			r.log.Error("Failed to scan child count", zap.Error(err))
+			return nil, fmt.Errorf("failed to scan child count: %w", err)
+		}
+		counts[parentID] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate child counts: %w", err)
+	}
+	return counts, nil
+}
+
+// GetChildrenPage fetches up to limit children of parentID ordered by path,
+// starting strictly after afterPath (pass "" for the first page), for
+// paging through a parent's children once GetComments's ChildrenPerNode
+// bound has been reached.
+func (r *Repository) GetChildrenPage(ctx context.Context, parentID int64, afterPath string, limit int) ([]*models.Comment, error) {
+	rows, err := r.db.QueryWithRetry(ctx, retryStrategy, childrenPageQuery, parentID, afterPath, limit)
+	if err != nil {
+		r.log.Error("Failed to get children page", zap.Int64("parent_id", parentID), zap.Error(err))
+		return nil, fmt.Errorf("failed to get children page: %w", err)
+	}
+	defer rows.Close()
+
+	var comments []*models.Comment
+	for rows.Next() {
+		comment, err := scanComment(rows)
+		if err != nil {
+			r.log.Error("Failed to scan children page comment", zap.Error(err))
+			return nil, fmt.Errorf("failed to scan children page comment: %w", err)
+		}
+		comments = append(comments, comment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate children page rows: %w", err)
+	}
 	return comments, nil
 }
 
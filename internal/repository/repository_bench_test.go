@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"CommentTree/internal/models"
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// setupBenchRepo connects to TEST_DATABASE_URL and seeds rootCount top-level
+// comments with a handful of children each, returning the repository and the
+// seeded root comments plus a cleanup func. Skips the benchmark when
+// no test database is configured, since these benchmarks need real
+// round-trips to demonstrate the N+1 they remove.
+func setupBenchRepo(b *testing.B, rootCount int) (*Repository, []*models.Comment, func()) {
+	b.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		b.Skip("TEST_DATABASE_URL not set, skipping repository benchmark")
+	}
+
+	repo, err := NewRepository(dsn, nil, zap.NewNop())
+	if err != nil {
+		b.Fatalf("failed to connect to test database: %v", err)
+	}
+
+	ctx := context.Background()
+	roots := make([]*models.Comment, 0, rootCount)
+	for i := 0; i < rootCount; i++ {
+		rootID, err := repo.Create(ctx, models.Comment{
+			PathID: fmt.Sprintf("bench-root-%d", i),
+			Comm:   "bench root",
+			Status: models.StatusApproved,
+		})
+		if err != nil {
+			b.Fatalf("failed to create root comment: %v", err)
+		}
+		root, err := repo.GetByID(ctx, rootID)
+		if err != nil {
+			b.Fatalf("failed to load seeded root comment: %v", err)
+		}
+
+		for j := 0; j < 5; j++ {
+			if _, err := repo.Create(ctx, models.Comment{
+				ParentID: &rootID,
+				PathID:   fmt.Sprintf("bench-child-%d-%d", i, j),
+				Comm:     "bench child",
+				Status:   models.StatusApproved,
+			}); err != nil {
+				b.Fatalf("failed to create child comment: %v", err)
+			}
+		}
+		roots = append(roots, root)
+	}
+
+	cleanup := func() {
+		for _, root := range roots {
+			_ = repo.DeleteByPath(ctx, root.Path)
+		}
+	}
+	return repo, roots, cleanup
+}
+
+// benchmarkPerRootQueries reproduces the pre-batching GetAllCommentTrees
+// behavior: one GetChildrenByPath round-trip per top-level comment.
+func benchmarkPerRootQueries(b *testing.B, rootCount int) {
+	repo, roots, cleanup := setupBenchRepo(b, rootCount)
+	defer cleanup()
+	ctx := context.Background()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, root := range roots {
+			if _, err := repo.GetChildrenByPath(ctx, root.Path, true, "", ""); err != nil {
+				b.Fatalf("GetChildrenByPath failed: %v", err)
+			}
+		}
+	}
+}
+
+// benchmarkBatchedSubtrees is the batched replacement: every root's
+// descendants in a single GetSubtreesByPaths round-trip.
+func benchmarkBatchedSubtrees(b *testing.B, rootCount int) {
+	repo, roots, cleanup := setupBenchRepo(b, rootCount)
+	defer cleanup()
+	ctx := context.Background()
+
+	paths := make([]string, len(roots))
+	for i, root := range roots {
+		paths[i] = root.Path
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := repo.GetSubtreesByPaths(ctx, paths, true); err != nil {
+			b.Fatalf("GetSubtreesByPaths failed: %v", err)
+		}
+	}
+}
+
+func BenchmarkGetAllCommentTrees_PerRootQueries(b *testing.B) {
+	for _, rootCount := range []int{10, 50, 100} {
+		b.Run(fmt.Sprintf("roots=%d", rootCount), func(b *testing.B) {
+			benchmarkPerRootQueries(b, rootCount)
+		})
+	}
+}
+
+func BenchmarkGetAllCommentTrees_BatchedSubtrees(b *testing.B) {
+	for _, rootCount := range []int{10, 50, 100} {
+		b.Run(fmt.Sprintf("roots=%d", rootCount), func(b *testing.B) {
+			benchmarkBatchedSubtrees(b, rootCount)
+		})
+	}
+}
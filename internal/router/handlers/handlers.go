@@ -8,13 +8,14 @@ import (
 	"go.uber.org/zap"
 	"net/http"
 	"strconv"
+	"time"
 )
 
 type CommentHandler struct {
-	service service.Service
+	service *service.Service
 }
 
-func NewCommentHandler(service service.Service) *CommentHandler {
+func NewCommentHandler(service *service.Service) *CommentHandler {
 	return &CommentHandler{service: service}
 }
 
@@ -37,7 +38,7 @@ func (h *CommentHandler) CreateComment(c *ginext.Context) {
 		c.JSON(http.StatusBadRequest, ginext.H{"error": "ParentID it can't be negative"})
 	}
 
-	err := h.service.CreateComment(c.Request.Context(), *commentRequest)
+	err := h.service.CreateComment(c.Request.Context(), *commentRequest, c.ClientIP())
 	if err != nil {
 		log.Error("Failed to create comment", zap.Error(err))
 		c.JSON(http.StatusBadRequest, ginext.H{"error": "Failed to create comment"})
@@ -50,15 +51,17 @@ func (h *CommentHandler) GetCommentByID(c *ginext.Context) {
 	log := c.MustGet("logger").(*zap.Logger)
 	idStr := c.Query("parent")
 
+	sortBy := c.DefaultQuery("sort_by", "created_at")
+	sortOrder := c.DefaultQuery("sort_order", "asc")
+	voterKey := c.Query("voter_key")
+
 	if idStr == "" {
 		log.Debug("Parent ID not provided, fetching all top-level comments")
 
 		page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
-		sortBy := c.DefaultQuery("sort_by", "created_at")
-		sortOrder := c.DefaultQuery("sort_order", "asc")
 
-		paginatedResult, err := h.service.GetAllCommentTrees(c.Request.Context(), page, limit, sortBy, sortOrder)
+		paginatedResult, err := h.service.GetAllCommentTrees(c.Request.Context(), page, limit, sortBy, sortOrder, voterKey)
 		if err != nil {
 			log.Error("Failed to get all comment trees", zap.Error(err))
 			c.JSON(http.StatusInternalServerError, ginext.H{"error": "Failed to get all comments"})
@@ -76,7 +79,15 @@ func (h *CommentHandler) GetCommentByID(c *ginext.Context) {
 		return
 	}
 
-	comments, err := h.service.GetComments(c.Request.Context(), id)
+	maxDepth, _ := strconv.Atoi(c.Query("max_depth"))
+	childrenPerNode, _ := strconv.Atoi(c.Query("children_per_node"))
+	opts := models.GetCommentsOptions{
+		MaxDepth:        maxDepth,
+		ChildrenPerNode: childrenPerNode,
+		VoterKey:        voterKey,
+	}
+
+	comments, err := h.service.GetComments(c.Request.Context(), id, opts)
 	if err != nil {
 		log.Error("Failed to get comments", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, ginext.H{"error": "Failed to get comments"})
@@ -84,6 +95,32 @@ func (h *CommentHandler) GetCommentByID(c *ginext.Context) {
 	}
 	c.JSON(http.StatusOK, ginext.H{"comments": comments})
 }
+
+// GetCommentChildren serves GET /comments/:id/children?cursor=...&limit=...,
+// paging through a single comment's direct children once GetCommentByID's
+// children_per_node bound has left some of them unfetched.
+func (h *CommentHandler) GetCommentChildren(c *ginext.Context) {
+	log := c.MustGet("logger").(*zap.Logger)
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		log.Error("Failed to parse comment id", zap.Error(err))
+		c.JSON(http.StatusBadRequest, ginext.H{"error": "Invalid id"})
+		return
+	}
+
+	cursor := c.Query("cursor")
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	voterKey := c.Query("voter_key")
+
+	page, err := h.service.GetChildrenPage(c.Request.Context(), id, cursor, limit, voterKey)
+	if err != nil {
+		log.Error("Failed to get children page", zap.Int64("id", id), zap.Error(err))
+		c.JSON(http.StatusBadRequest, ginext.H{"error": "Failed to get children"})
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
 func (h *CommentHandler) DeleteComment(c *ginext.Context) {
 	log := c.MustGet("logger").(*zap.Logger)
 	log.Debug("Deleting comment")
@@ -113,13 +150,150 @@ func (h *CommentHandler) SearchComments(c *ginext.Context) {
 	log := c.MustGet("logger").(*zap.Logger)
 	query := c.Query("q")
 
+	opts := models.SearchOptions{
+		PathPrefix: c.Query("prefix"),
+	}
+	opts.Limit, _ = strconv.Atoi(c.DefaultQuery("limit", "20"))
+	opts.Offset, _ = strconv.Atoi(c.DefaultQuery("offset", "0"))
+	opts.MinRank, _ = strconv.ParseFloat(c.DefaultQuery("min_rank", "0"), 64)
+	if dateFrom, err := time.Parse(time.RFC3339, c.Query("date_from")); err == nil {
+		opts.DateFrom = &dateFrom
+	}
+	if dateTo, err := time.Parse(time.RFC3339, c.Query("date_to")); err == nil {
+		opts.DateTo = &dateTo
+	}
+
 	log.Debug("Searching for comments", zap.String("query", query))
-	results, err := h.service.SearchComments(c.Request.Context(), query)
+	results, total, err := h.service.SearchComments(c.Request.Context(), query, opts)
 	if err != nil {
 		log.Error("Failed to search comments", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, ginext.H{"error": "Failed to perform search"})
 		return
 	}
 
-	c.JSON(http.StatusOK, ginext.H{"comments": results})
+	c.JSON(http.StatusOK, ginext.H{"comments": results, "total": total})
+}
+
+var statusByName = map[string]int8{
+	"pending":  models.StatusPending,
+	"approved": models.StatusApproved,
+	"rejected": models.StatusRejected,
+}
+
+// ListPendingComments serves GET /admin/comments?status=pending for the
+// moderation queue.
+func (h *CommentHandler) ListPendingComments(c *ginext.Context) {
+	log := c.MustGet("logger").(*zap.Logger)
+
+	statusName := c.DefaultQuery("status", "pending")
+	status, ok := statusByName[statusName]
+	if !ok {
+		c.JSON(http.StatusBadRequest, ginext.H{"error": "Invalid status"})
+		return
+	}
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	result, err := h.service.ListCommentsByStatus(c.Request.Context(), status, page, limit)
+	if err != nil {
+		log.Error("Failed to list comments by status", zap.String("status", statusName), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ginext.H{"error": "Failed to list comments"})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// ApproveComment serves POST /admin/comments/:id/approve.
+func (h *CommentHandler) ApproveComment(c *ginext.Context) {
+	h.moderateComment(c, models.StatusApproved)
+}
+
+// RejectComment serves POST /admin/comments/:id/reject.
+func (h *CommentHandler) RejectComment(c *ginext.Context) {
+	h.moderateComment(c, models.StatusRejected)
+}
+
+// VoteRequest is the JSON body accepted by POST /comments/:id/vote.
+type VoteRequest struct {
+	Value int8 `json:"value"`
+}
+
+// VoteComment serves POST /comments/:id/vote?voter_key=... with a
+// {"value": 1|-1} body.
+func (h *CommentHandler) VoteComment(c *ginext.Context) {
+	log := c.MustGet("logger").(*zap.Logger)
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		log.Error("Failed to parse comment id", zap.Error(err))
+		c.JSON(http.StatusBadRequest, ginext.H{"error": "Invalid id"})
+		return
+	}
+
+	voterKey := c.Query("voter_key")
+	if voterKey == "" {
+		c.JSON(http.StatusBadRequest, ginext.H{"error": "voter_key is required"})
+		return
+	}
+
+	var req VoteRequest
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		log.Error("Failed to decode vote request body", zap.Error(err))
+		c.JSON(http.StatusBadRequest, ginext.H{"error": "Invalid request body"})
+		return
+	}
+
+	score, err := h.service.Vote(c.Request.Context(), id, voterKey, req.Value)
+	if err != nil {
+		log.Error("Failed to vote on comment", zap.Int64("id", id), zap.Error(err))
+		c.JSON(http.StatusBadRequest, ginext.H{"error": "Failed to vote on comment"})
+		return
+	}
+	c.JSON(http.StatusOK, ginext.H{"score": score})
+}
+
+// UnvoteComment serves DELETE /comments/:id/vote?voter_key=....
+func (h *CommentHandler) UnvoteComment(c *ginext.Context) {
+	log := c.MustGet("logger").(*zap.Logger)
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		log.Error("Failed to parse comment id", zap.Error(err))
+		c.JSON(http.StatusBadRequest, ginext.H{"error": "Invalid id"})
+		return
+	}
+
+	voterKey := c.Query("voter_key")
+	if voterKey == "" {
+		c.JSON(http.StatusBadRequest, ginext.H{"error": "voter_key is required"})
+		return
+	}
+
+	score, err := h.service.Unvote(c.Request.Context(), id, voterKey)
+	if err != nil {
+		log.Error("Failed to remove vote on comment", zap.Int64("id", id), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ginext.H{"error": "Failed to remove vote on comment"})
+		return
+	}
+	c.JSON(http.StatusOK, ginext.H{"score": score})
+}
+
+func (h *CommentHandler) moderateComment(c *ginext.Context, status int8) {
+	log := c.MustGet("logger").(*zap.Logger)
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		log.Error("Failed to parse comment id", zap.Error(err))
+		c.JSON(http.StatusBadRequest, ginext.H{"error": "Invalid id"})
+		return
+	}
+	moderatorID, _ := strconv.ParseInt(c.GetHeader("X-Moderator-ID"), 10, 64)
+
+	comment, err := h.service.ModerateComment(c.Request.Context(), id, status, moderatorID)
+	if err != nil {
+		log.Error("Failed to moderate comment", zap.Int64("id", id), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, ginext.H{"error": "Failed to moderate comment"})
+		return
+	}
+	c.JSON(http.StatusOK, ginext.H{"comment": comment})
 }
@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"github.com/wb-go/wbf/ginext"
+	"net/http"
+)
+
+// AuthMiddleware guards admin-only routes. Implementations decide how a
+// request is authenticated; swap in a different AuthMiddleware (JWT,
+// session cookie, ...) without changing the routes that depend on it.
+type AuthMiddleware interface {
+	Authorize() ginext.HandlerFunc
+}
+
+// APIKeyAuth is a minimal AuthMiddleware that checks a static API key
+// supplied via the X-API-Key header. An empty Key rejects every request,
+// so the admin routes fail closed if no key has been configured.
+type APIKeyAuth struct {
+	Key string
+}
+
+func NewAPIKeyAuth(key string) *APIKeyAuth {
+	return &APIKeyAuth{Key: key}
+}
+
+func (a *APIKeyAuth) Authorize() ginext.HandlerFunc {
+	return func(c *ginext.Context) {
+		if a.Key == "" || c.GetHeader("X-API-Key") != a.Key {
+			c.JSON(http.StatusUnauthorized, ginext.H{"error": "unauthorized"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,15 @@
+package middleware
+
+import (
+	"github.com/wb-go/wbf/ginext"
+	"go.uber.org/zap"
+)
+
+// LoggingMiddleware attaches the request-scoped logger to the gin context
+// under the "logger" key, which handlers retrieve via c.MustGet("logger").
+func LoggingMiddleware(log *zap.Logger) ginext.HandlerFunc {
+	return func(c *ginext.Context) {
+		c.Set("logger", log)
+		c.Next()
+	}
+}
@@ -1,6 +1,7 @@
 package router
 
 import (
+	"CommentTree/internal/activitypub"
 	"CommentTree/internal/router/handlers"
 	"CommentTree/internal/router/middleware"
 	"github.com/wb-go/wbf/ginext"
@@ -10,13 +11,19 @@ import (
 type Router struct {
 	rout    *ginext.Engine
 	handler *handlers.CommentHandler
+	auth    middleware.AuthMiddleware
+	ap      *activitypub.Handler
 	log     *zap.Logger
 }
 
-func NewRouter(mode string, handler *handlers.CommentHandler, log *zap.Logger) *Router {
+// NewRouter wires up every route this instance serves. ap is optional: pass
+// nil to run without ActivityPub federation.
+func NewRouter(mode string, handler *handlers.CommentHandler, auth middleware.AuthMiddleware, ap *activitypub.Handler, log *zap.Logger) *Router {
 	router := Router{
 		rout:    ginext.New(mode),
 		handler: handler,
+		auth:    auth,
+		ap:      ap,
 		log:     log.Named("router"),
 	}
 	router.setupRouter()
@@ -28,8 +35,26 @@ func (r *Router) setupRouter() {
 	r.rout.POST("/comments", r.handler.CreateComment)
 	r.rout.GET("/comments", r.handler.GetCommentByID)
 	r.rout.DELETE("/comments/:id", r.handler.DeleteComment)
+	r.rout.POST("/comments/:id/vote", r.handler.VoteComment)
+	r.rout.DELETE("/comments/:id/vote", r.handler.UnvoteComment)
+	r.rout.GET("/comments/:id/children", r.handler.GetCommentChildren)
 	r.rout.GET("/search", r.handler.SearchComments)
 
+	admin := r.rout.Group("/admin")
+	admin.Use(r.auth.Authorize())
+	admin.GET("/comments", r.handler.ListPendingComments)
+	admin.POST("/comments/:id/approve", r.handler.ApproveComment)
+	admin.POST("/comments/:id/reject", r.handler.RejectComment)
+
+	if r.ap != nil {
+		r.rout.GET("/actor", r.ap.Actor)
+		r.rout.POST("/inbox", r.ap.Inbox)
+		// Lives outside /comments/* so its :path_id wildcard doesn't collide
+		// with the public API's :id wildcard on gin's router (a shared node
+		// with two different wildcard names panics at startup).
+		r.rout.GET("/activitypub/comments/:path_id/activity", r.ap.Note)
+	}
+
 	r.rout.GET("/", func(c *ginext.Context) {
 		c.File("./static/index.html")
 	})
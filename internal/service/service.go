@@ -3,51 +3,167 @@ package service
 import (
 	"CommentTree/internal/models"
 	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"github.com/google/uuid"
 	"go.uber.org/zap"
 	"strings"
+	"sync"
 	"time"
 )
 
 type Repository interface {
-	Create(ctx context.Context, c models.Comment) error
+	Create(ctx context.Context, c models.Comment) (int64, error)
 	GetByID(ctx context.Context, id int64) (*models.Comment, error)
-	GetChildrenByPath(ctx context.Context, path string) ([]*models.Comment, error)
+	GetByPathID(ctx context.Context, pathID string) (*models.Comment, error)
+	GetByRemoteObjectURL(ctx context.Context, objectURL string) (*models.Comment, error)
+	GetChildrenByPath(ctx context.Context, path string, approvedOnly bool, sortBy, sortOrder string) ([]*models.Comment, error)
+	GetBoundedSubtree(ctx context.Context, rootID int64, maxDepth, childrenPerNode int, approvedOnly bool) ([]*models.Comment, error)
+	CountDescendants(ctx context.Context, rootPath string, rootID int64, approvedOnly bool) (int, error)
+	CountChildrenByParents(ctx context.Context, parentIDs []int64) (map[int64]int, error)
+	GetChildrenPage(ctx context.Context, parentID int64, afterPath string, limit int) ([]*models.Comment, error)
 	DeleteByPath(ctx context.Context, path string) error
-	GetTopLevelComments(ctx context.Context, limit, offset int, sortBy, sortOrder string) ([]*models.Comment, int, error)
-	SearchByText(ctx context.Context, query string) ([]*models.Comment, error)
+	GetTopLevelComments(ctx context.Context, limit, offset int, sortBy, sortOrder string, approvedOnly bool) ([]*models.Comment, int, error)
+	SearchByText(ctx context.Context, query string, opts models.SearchOptions) ([]*models.Comment, int, error)
+	GetSubtreesByPaths(ctx context.Context, paths []string, approvedOnly bool) (map[string][]*models.Comment, error)
+	ListByStatus(ctx context.Context, status int8, limit, offset int) ([]*models.Comment, int, error)
+	SetStatus(ctx context.Context, id int64, status int8, moderatedBy int64, moderatedAt time.Time) (*models.Comment, error)
+	Vote(ctx context.Context, commentID int64, voterKey string, value int8) (score, voteCount int, err error)
+	Unvote(ctx context.Context, commentID int64, voterKey string) (score, voteCount int, err error)
+	GetVotesByVoter(ctx context.Context, voterKey string, commentIDs []int64) (map[int64]int8, error)
 }
 
+// FederationPublisher is notified whenever a local comment becomes publicly
+// visible (created unmoderated, or approved by a moderator), so it can be
+// announced to ActivityPub followers. It is optional: Service works the same
+// without one, just without outbound federation.
+type FederationPublisher interface {
+	PublishComment(comment *models.Comment)
+}
+
+// treeAssemblyWorkers bounds the concurrency used when building trees for a
+// page of top-level comments out of a single batched subtree fetch.
+const treeAssemblyWorkers = 8
+
+// StatusChangeHook is invoked whenever a comment's moderation status
+// changes, so downstream notifiers (e.g. an email/webhook dispatcher) can
+// subscribe without coupling the moderation flow to them directly.
+type StatusChangeHook func(comment *models.Comment, oldStatus, newStatus int8)
+
 type Service struct {
 	repo Repository
 	log  *zap.Logger
+
+	// moderationEnabled gates whether newly created comments start out
+	// pending moderator approval or are published immediately.
+	moderationEnabled bool
+
+	hooksMu sync.Mutex
+	hooks   []StatusChangeHook
+
+	publisher FederationPublisher
 }
 
-func NewService(repo Repository, log *zap.Logger) *Service {
+func NewService(repo Repository, log *zap.Logger, moderationEnabled bool) *Service {
 	return &Service{
-		repo: repo,
-		log:  log.Named("service"),
+		repo:              repo,
+		log:               log.Named("service"),
+		moderationEnabled: moderationEnabled,
 	}
 }
 
-func (s *Service) CreateComment(ctx context.Context, cr models.CommentRequest) error {
+// OnCommentStatusChange registers a hook called after a comment's
+// moderation status changes via ModerateComment.
+func (s *Service) OnCommentStatusChange(hook StatusChangeHook) {
+	s.hooksMu.Lock()
+	defer s.hooksMu.Unlock()
+	s.hooks = append(s.hooks, hook)
+}
+
+// SetFederationPublisher wires in the ActivityPub outbox. Call it once during
+// startup; leave it unset to run without federation.
+func (s *Service) SetFederationPublisher(publisher FederationPublisher) {
+	s.publisher = publisher
+}
+
+func (s *Service) CreateComment(ctx context.Context, cr models.CommentRequest, ip string) error {
 	pathID := uuid.New().String()
+	status := models.StatusApproved
+	if s.moderationEnabled {
+		status = models.StatusPending
+	}
 	comment := models.Comment{
 		ParentID:  cr.ParentID,
 		PathID:    pathID,
 		Comm:      cr.Comment,
 		CreatedAt: time.Now(),
+		Status:    status,
+		IP:        ip,
 	}
-	err := s.repo.Create(ctx, comment)
+	id, err := s.repo.Create(ctx, comment)
 	if err != nil {
 		s.log.Error("Failed to create comment", zap.Error(err))
 		return fmt.Errorf("failed to create comment: %w", err)
 	}
+
+	if s.publisher != nil && status == models.StatusApproved {
+		comment.ID = id
+		s.publisher.PublishComment(&comment)
+	}
 	return nil
 }
 
-func (s *Service) GetComments(ctx context.Context, id int64) (*models.Comment, error) {
+// CreateRemoteReply records a comment delivered by a federated Create{Note}
+// activity. It is idempotent on objectURL so redelivered activities (a common
+// ActivityPub retry pattern) don't create duplicate comments, and it bypasses
+// moderation since the remote server is the one responsible for its users'
+// content.
+func (s *Service) CreateRemoteReply(ctx context.Context, parentID int64, text, actorURL, objectURL string) error {
+	if existing, err := s.repo.GetByRemoteObjectURL(ctx, objectURL); err == nil {
+		s.log.Debug("Ignoring already-delivered remote reply", zap.Int64("id", existing.ID), zap.String("object_url", objectURL))
+		return nil
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		s.log.Error("Failed to check for existing remote reply", zap.Error(err))
+		return fmt.Errorf("failed to check for existing remote reply: %w", err)
+	}
+
+	comment := models.Comment{
+		ParentID:        &parentID,
+		PathID:          uuid.New().String(),
+		Comm:            text,
+		CreatedAt:       time.Now(),
+		Status:          models.StatusApproved,
+		RemoteActorURL:  &actorURL,
+		RemoteObjectURL: &objectURL,
+	}
+	if _, err := s.repo.Create(ctx, comment); err != nil {
+		s.log.Error("Failed to create remote reply", zap.Error(err))
+		return fmt.Errorf("failed to create remote reply: %w", err)
+	}
+	return nil
+}
+
+// GetCommentByPathID resolves a comment by its public path_id, for serving
+// its ActivityPub Note representation.
+func (s *Service) GetCommentByPathID(ctx context.Context, pathID string) (*models.Comment, error) {
+	comment, err := s.repo.GetByPathID(ctx, pathID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		s.log.Error("Failed to get comment by path_id", zap.Error(err))
+		return nil, fmt.Errorf("failed to get comment by path_id: %w", err)
+	}
+	return comment, nil
+}
+
+// GetComments returns the comment tree rooted at id, bounded by opts so a
+// deeply nested or wide thread doesn't get materialized in full on every
+// request. Nodes whose children were cut off by opts have HasMore and
+// NextCursor set, for fetching the rest via GetChildrenPage.
+func (s *Service) GetComments(ctx context.Context, id int64, opts models.GetCommentsOptions) (*models.Comment, error) {
 	s.log.Debug("Getting comments tree starting from id", zap.Int64("id", id))
 
 	root, err := s.repo.GetByID(ctx, id)
@@ -56,19 +172,147 @@ func (s *Service) GetComments(ctx context.Context, id int64) (*models.Comment, e
 		return nil, fmt.Errorf("failed to get root comment: %w", err)
 	}
 
-	allComments, err := s.repo.GetChildrenByPath(ctx, root.Path)
+	allComments, err := s.repo.GetBoundedSubtree(ctx, id, opts.MaxDepth, opts.ChildrenPerNode, true)
+	if err != nil {
+		s.log.Error("Failed to get bounded subtree", zap.Error(err))
+		return nil, fmt.Errorf("failed to get bounded subtree: %w", err)
+	}
+	s.log.Debug("Got bounded subtree", zap.Int("count", len(allComments)))
+
+	tree := buildTree(root, allComments)
+
+	if total, err := s.repo.CountDescendants(ctx, root.Path, root.ID, true); err != nil {
+		s.log.Error("Failed to count descendants", zap.Error(err))
+	} else {
+		tree.TotalDescendants = total
+	}
+
+	if err := s.annotatePagination(ctx, allComments); err != nil {
+		s.log.Error("Failed to annotate pagination", zap.Error(err))
+	}
+
+	if opts.VoterKey != "" {
+		// tree is not one of allComments when buildTree fell back to root.
+		if err := s.applyMyVotes(ctx, opts.VoterKey, append(allComments, tree)); err != nil {
+			s.log.Error("Failed to load voter's own votes", zap.Error(err))
+		}
+	}
+	return tree, nil
+}
+
+// annotatePagination sets HasMore/NextCursor on every comment in comments
+// whose actual fetched children (len(c.Children), populated by buildTree)
+// fall short of its real total child count.
+func (s *Service) annotatePagination(ctx context.Context, comments []*models.Comment) error {
+	ids := make([]int64, len(comments))
+	for i, c := range comments {
+		ids[i] = c.ID
+	}
+
+	totals, err := s.repo.CountChildrenByParents(ctx, ids)
+	if err != nil {
+		return fmt.Errorf("failed to count children by parents: %w", err)
+	}
+	for _, c := range comments {
+		total, ok := totals[c.ID]
+		if !ok || total <= len(c.Children) {
+			continue
+		}
+		c.HasMore = true
+		lastPath := ""
+		if n := len(c.Children); n > 0 {
+			lastPath = c.Children[n-1].Path
+		}
+		c.NextCursor = encodeCursor(lastPath)
+	}
+	return nil
+}
+
+// GetChildrenPage returns the next page of parentID's direct children,
+// ordered by path, for a parent whose GetComments ChildrenPerNode bound left
+// some children unfetched. cursor is the opaque NextCursor from a previous
+// GetComments or GetChildrenPage call; pass "" for the first page.
+func (s *Service) GetChildrenPage(ctx context.Context, parentID int64, cursor string, limit int, voterKey string) (*models.ChildrenPage, error) {
+	if limit < 1 || limit > 100 {
+		limit = 10
+	}
+
+	afterPath := ""
+	if cursor != "" {
+		var err error
+		afterPath, err = decodeCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	children, err := s.repo.GetChildrenPage(ctx, parentID, afterPath, limit+1)
+	if err != nil {
+		s.log.Error("Failed to get children page", zap.Int64("parent_id", parentID), zap.Error(err))
+		return nil, fmt.Errorf("failed to get children page: %w", err)
+	}
+
+	page := &models.ChildrenPage{Comments: children}
+	if len(children) > limit {
+		page.Comments = children[:limit]
+		page.HasMore = true
+		page.NextCursor = encodeCursor(page.Comments[len(page.Comments)-1].Path)
+	}
+
+	if voterKey != "" {
+		if err := s.applyMyVotes(ctx, voterKey, page.Comments); err != nil {
+			s.log.Error("Failed to load voter's own votes", zap.Error(err))
+		}
+	}
+	return page, nil
+}
+
+// encodeCursor/decodeCursor turn a comment's materialized path into the
+// opaque cursor string exposed over the API, keeping the path format an
+// internal detail clients can't rely on.
+func encodeCursor(path string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(path))
+}
+
+func decodeCursor(cursor string) (string, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", fmt.Errorf("invalid cursor: %w", err)
+	}
+	return string(b), nil
+}
+
+// applyMyVotes looks up voterKey's votes on the given comments in a single
+// batched query and sets MyVote on each one that has a vote.
+func (s *Service) applyMyVotes(ctx context.Context, voterKey string, comments []*models.Comment) error {
+	ids := make([]int64, len(comments))
+	for i, c := range comments {
+		ids[i] = c.ID
+	}
+
+	votes, err := s.repo.GetVotesByVoter(ctx, voterKey, ids)
 	if err != nil {
-		s.log.Error("Failed to get children", zap.Error(err))
-		return nil, fmt.Errorf("failed to get children: %w", err)
+		return fmt.Errorf("failed to get votes by voter: %w", err)
 	}
-	s.log.Debug("Got all comments for the subtree", zap.Int("count", len(allComments)))
+	for _, c := range comments {
+		if v, ok := votes[c.ID]; ok {
+			value := v
+			c.MyVote = &value
+		}
+	}
+	return nil
+}
 
+// buildTree assembles a single comment tree in-process from a flat list of
+// the root's descendants (as returned by GetChildrenByPath or a batched
+// GetSubtreesByPaths lookup).
+func buildTree(root *models.Comment, allComments []*models.Comment) *models.Comment {
 	if len(allComments) <= 1 {
 		root.Children = []*models.Comment{}
-		return root, nil
+		return root
 	}
 
-	commentMap := make(map[int64]*models.Comment)
+	commentMap := make(map[int64]*models.Comment, len(allComments))
 	for _, comment := range allComments {
 		comment.Children = []*models.Comment{}
 		commentMap[comment.ID] = comment
@@ -82,11 +326,11 @@ func (s *Service) GetComments(ctx context.Context, id int64) (*models.Comment, e
 		}
 	}
 
-	if rootInTree, ok := commentMap[id]; ok {
-		return rootInTree, nil
+	if rootInTree, ok := commentMap[root.ID]; ok {
+		return rootInTree
 	}
 
-	return root, nil
+	return root
 }
 
 func (s *Service) DeleteComments(ctx context.Context, id int64) error {
@@ -104,7 +348,7 @@ func (s *Service) DeleteComments(ctx context.Context, id int64) error {
 	return nil
 }
 
-func (s *Service) GetAllCommentTrees(ctx context.Context, page, limit int, sortBy, sortOrder string) (*models.PaginatedComments, error) {
+func (s *Service) GetAllCommentTrees(ctx context.Context, page, limit int, sortBy, sortOrder, voterKey string) (*models.PaginatedComments, error) {
 	if page < 1 {
 		page = 1
 	}
@@ -114,20 +358,37 @@ func (s *Service) GetAllCommentTrees(ctx context.Context, page, limit int, sortB
 	offset := (page - 1) * limit
 
 	s.log.Debug("Getting paginated top-level comments", zap.Int("page", page), zap.Int("limit", limit))
-	topLevelComments, total, err := s.repo.GetTopLevelComments(ctx, limit, offset, sortBy, sortOrder)
+	topLevelComments, total, err := s.repo.GetTopLevelComments(ctx, limit, offset, sortBy, sortOrder, true)
 	if err != nil {
 		s.log.Error("Failed to get top-level comments", zap.Error(err))
 		return nil, fmt.Errorf("failed to get top-level comments: %w", err)
 	}
 
-	var allTrees []*models.Comment
-	for _, rootComment := range topLevelComments {
-		fullTree, err := s.GetComments(ctx, rootComment.ID)
-		if err != nil {
-			s.log.Error("Failed to build tree for root comment", zap.Int64("id", rootComment.ID), zap.Error(err))
-			continue
+	if len(topLevelComments) == 0 {
+		return &models.PaginatedComments{Comments: []*models.Comment{}, Total: total, Page: page, Limit: limit}, nil
+	}
+
+	paths := make([]string, len(topLevelComments))
+	for i, rootComment := range topLevelComments {
+		paths[i] = rootComment.Path
+	}
+
+	subtrees, err := s.repo.GetSubtreesByPaths(ctx, paths, true)
+	if err != nil {
+		s.log.Error("Failed to get subtrees for top-level comments", zap.Error(err))
+		return nil, fmt.Errorf("failed to get subtrees for top-level comments: %w", err)
+	}
+
+	allTrees := assembleTrees(topLevelComments, subtrees)
+
+	if voterKey != "" {
+		all := append([]*models.Comment(nil), topLevelComments...)
+		for _, comments := range subtrees {
+			all = append(all, comments...)
+		}
+		if err := s.applyMyVotes(ctx, voterKey, all); err != nil {
+			s.log.Error("Failed to load voter's own votes", zap.Error(err))
 		}
-		allTrees = append(allTrees, fullTree)
 	}
 
 	return &models.PaginatedComments{
@@ -138,10 +399,118 @@ func (s *Service) GetAllCommentTrees(ctx context.Context, page, limit int, sortB
 	}, nil
 }
 
-func (s *Service) SearchComments(ctx context.Context, query string) ([]*models.Comment, error) {
+// assembleTrees builds one tree per top-level comment from a single batched
+// subtree fetch, spreading the in-process assembly work across a bounded
+// worker pool so a large page size doesn't serialize on tree building.
+func assembleTrees(topLevelComments []*models.Comment, subtrees map[string][]*models.Comment) []*models.Comment {
+	trees := make([]*models.Comment, len(topLevelComments))
+
+	workers := treeAssemblyWorkers
+	if workers > len(topLevelComments) {
+		workers = len(topLevelComments)
+	}
+
+	jobs := make(chan int, len(topLevelComments))
+	for i := range topLevelComments {
+		jobs <- i
+	}
+	close(jobs)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				root := topLevelComments[i]
+				trees[i] = buildTree(root, subtrees[root.Path])
+			}
+		}()
+	}
+	wg.Wait()
+
+	return trees
+}
+
+func (s *Service) SearchComments(ctx context.Context, query string, opts models.SearchOptions) ([]*models.Comment, int, error) {
 	s.log.Debug("Searching for comments", zap.String("query", query))
 	if len(strings.TrimSpace(query)) < 3 {
-		return []*models.Comment{}, nil
+		return []*models.Comment{}, 0, nil
+	}
+	return s.repo.SearchByText(ctx, query, opts)
+}
+
+// ListCommentsByStatus returns the admin moderation queue for a given status.
+func (s *Service) ListCommentsByStatus(ctx context.Context, status int8, page, limit int) (*models.PaginatedComments, error) {
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 10
+	}
+	offset := (page - 1) * limit
+
+	comments, total, err := s.repo.ListByStatus(ctx, status, limit, offset)
+	if err != nil {
+		s.log.Error("Failed to list comments by status", zap.Int8("status", status), zap.Error(err))
+		return nil, fmt.Errorf("failed to list comments by status: %w", err)
+	}
+	return &models.PaginatedComments{Comments: comments, Total: total, Page: page, Limit: limit}, nil
+}
+
+// ModerateComment approves or rejects a comment and notifies any hooks
+// registered via OnCommentStatusChange.
+func (s *Service) ModerateComment(ctx context.Context, id int64, status int8, moderatorID int64) (*models.Comment, error) {
+	before, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		s.log.Error("Failed to get comment before moderation", zap.Int64("id", id), zap.Error(err))
+		return nil, fmt.Errorf("failed to get comment before moderation: %w", err)
+	}
+
+	updated, err := s.repo.SetStatus(ctx, id, status, moderatorID, time.Now())
+	if err != nil {
+		s.log.Error("Failed to set comment status", zap.Int64("id", id), zap.Error(err))
+		return nil, fmt.Errorf("failed to set comment status: %w", err)
+	}
+
+	if before.Status != updated.Status {
+		s.hooksMu.Lock()
+		hooks := append([]StatusChangeHook(nil), s.hooks...)
+		s.hooksMu.Unlock()
+		for _, hook := range hooks {
+			hook(updated, before.Status, updated.Status)
+		}
+	}
+
+	if s.publisher != nil && before.Status != models.StatusApproved && updated.Status == models.StatusApproved {
+		s.publisher.PublishComment(updated)
+	}
+
+	return updated, nil
+}
+
+// Vote records voterKey's upvote (value 1) or downvote (value -1) on a
+// comment, replacing any earlier vote by the same voter, and returns the
+// comment's updated score.
+func (s *Service) Vote(ctx context.Context, commentID int64, voterKey string, value int8) (int, error) {
+	if value != 1 && value != -1 {
+		return 0, fmt.Errorf("vote value must be 1 or -1, got %d", value)
+	}
+	score, _, err := s.repo.Vote(ctx, commentID, voterKey, value)
+	if err != nil {
+		s.log.Error("Failed to vote on comment", zap.Int64("id", commentID), zap.Error(err))
+		return 0, fmt.Errorf("failed to vote on comment: %w", err)
+	}
+	return score, nil
+}
+
+// Unvote removes voterKey's vote on a comment, if any, and returns the
+// comment's updated score.
+func (s *Service) Unvote(ctx context.Context, commentID int64, voterKey string) (int, error) {
+	score, _, err := s.repo.Unvote(ctx, commentID, voterKey)
+	if err != nil {
+		s.log.Error("Failed to remove vote on comment", zap.Int64("id", commentID), zap.Error(err))
+		return 0, fmt.Errorf("failed to remove vote on comment: %w", err)
 	}
-	return s.repo.SearchByText(ctx, query)
+	return score, nil
 }
@@ -0,0 +1,26 @@
+package logger
+
+import (
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+// NewLogger builds a zap.Logger configured for the given level
+// ("debug" enables development mode with caller/stacktrace info;
+// anything else builds a production logger).
+func NewLogger(level string) (*zap.Logger, error) {
+	if level == "debug" {
+		log, err := zap.NewDevelopment()
+		if err != nil {
+			return nil, fmt.Errorf("failed to build development logger: %w", err)
+		}
+		return log, nil
+	}
+
+	log, err := zap.NewProduction()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build production logger: %w", err)
+	}
+	return log, nil
+}